@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"conf"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"journal"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"web/resource"
+)
+
+const defaultWebAddress = "127.0.0.1:8090"
+
+//命令行子命令，通过web服务控制正在运行的进程
+var commands = map[string]func(args []string) error{
+	"sync":          syncCommand,
+	"journal":       journalCommand,
+	"hash-password": hashPasswordCommand,
+	"vault":         vaultCommand,
+	"validate":      validateCommand,
+}
+
+//访问web服务的公共参数
+type webClient struct {
+	addr     *string
+	token    *string
+	user     *string
+	password *string
+	insecure *bool
+}
+
+func newWebClient(flags *flag.FlagSet) *webClient {
+	return &webClient{
+		addr:     flags.String("addr", defaultWebAddress, "web server address, https://host:port for tls"),
+		token:    flags.String("token", os.Getenv("AUTOSFTP_TOKEN"), "bearer token, default $AUTOSFTP_TOKEN"),
+		user:     flags.String("user", "", "basic auth user"),
+		password: flags.String("password", os.Getenv("AUTOSFTP_PASSWORD"), "basic auth password, default $AUTOSFTP_PASSWORD"),
+		insecure: flags.Bool("insecure", false, "skip tls certificate verification"),
+	}
+}
+
+func (c *webClient) do(method, path string) (int, []byte, error) {
+	base := *c.addr
+	if !strings.HasPrefix(base, "http://") && !strings.HasPrefix(base, "https://") {
+		base = "http://" + base
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(base, "/")+path, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(*c.token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+*c.token)
+	}else if len(*c.user) != 0 {
+		req.SetBasicAuth(*c.user, *c.password)
+	}
+	client := http.DefaultClient
+	if *c.insecure {
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request %s failed:%v", *c.addr, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
+
+//触发项目立即检测并上传：sync [-addr host:port] [-token token] <project>
+func syncCommand(args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	client := newWebClient(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: sync [-addr host:port] [-token token | -user user -password password] <project>")
+	}
+	code, body, err := client.do(http.MethodPost, fmt.Sprintf("/%s/sync", url.PathEscape(flags.Arg(0))))
+	if err != nil {
+		return err
+	}
+	if code != http.StatusOK || strings.TrimSpace(string(body)) != "OK" {
+		return fmt.Errorf("sync %s failed:%s", flags.Arg(0), strings.TrimSpace(string(body)))
+	}
+	fmt.Println(flags.Arg(0), "sync triggered")
+	return nil
+}
+
+//查询传输日志：journal [-since 1h] [-path sub/dir] [-result error] <project>
+//指定-file时直接读取本地的传输日志文件，不需要web服务
+func journalCommand(args []string) error {
+	flags := flag.NewFlagSet("journal", flag.ExitOnError)
+	client := newWebClient(flags)
+	file := flags.String("file", "", "read the journal file directly instead of querying the web server")
+	since := flags.String("since", "", "start time, RFC3339, 2006-01-02 15:04:05 or duration ago like 24h")
+	until := flags.String("until", "", "end time, same format as -since")
+	path := flags.String("path", "", "relative path, matches the path and everything under it, or a glob")
+	op := flags.String("op", "", "operation: put, mkdir, remove, rmdir, rename")
+	result := flags.String("result", "", "result: ok, error")
+	cycle := flags.String("cycle", "", "sync cycle id")
+	limit := flags.Int("limit", 50, "max records, 0 for unlimited")
+	jsonOutput := flags.Bool("json", false, "print records as json lines")
+	flags.Parse(args)
+	if (len(*file) == 0) != (flags.NArg() == 1) || flags.NArg() > 1 {
+		return errors.New("usage: journal [-addr host:port] [-since 24h] [-until time] [-path path] [-op op] [-result ok|error] [-limit n] [-json] <project> | journal -file journal_file [...]")
+	}
+	query := url.Values{}
+	for name, value := range map[string]string{"since": *since, "until": *until, "path": *path, "op": *op, "result": *result, "cycle": *cycle} {
+		if len(value) != 0 {
+			query.Set(name, value)
+		}
+	}
+	query.Set("limit", strconv.Itoa(*limit))
+	var records []journal.Record
+	if len(*file) != 0 {
+		filter, err := resource.ParseJournalFilter(query, time.Now())
+		if err != nil {
+			return err
+		}
+		if records, err = journal.Read(*file, filter); err != nil {
+			return err
+		}
+	}else{
+		code, body, err := client.do(http.MethodGet, fmt.Sprintf("/%s/projects/%s/journal?%s", resource.ApiPrefix, url.PathEscape(flags.Arg(0)), query.Encode()))
+		if err != nil {
+			return err
+		}
+		if code != http.StatusOK {
+			return fmt.Errorf("query journal of %s failed:%s", flags.Arg(0), strings.TrimSpace(string(body)))
+		}
+		if err := json.Unmarshal(body, &records); err != nil {
+			return err
+		}
+	}
+	//按时间先后输出
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if *jsonOutput {
+			line, _ := json.Marshal(r)
+			fmt.Println(string(line))
+			continue
+		}
+		size := "-"
+		if r.Op == journal.OpPut {
+			size = resource.HumanSize(r.Size)
+		}
+		line := fmt.Sprintf("%s  %s  %-6s %-5s %8s %6dms  %s", r.Time.Local().Format("2006-01-02 15:04:05"), r.Cycle, r.Op, r.Result, size, r.Duration, r.Path)
+		if len(r.Error) != 0 {
+			line += "  " + r.Error
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+//从标准输入读取一行，提示输出到标准错误
+func readSecret(name string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", name)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", fmt.Errorf("read %s failed:%v", name, err)
+	}
+	value := strings.TrimRight(line, "\r\n")
+	if len(value) == 0 {
+		return "", fmt.Errorf("%s is empty", name)
+	}
+	return value, nil
+}
+
+//生成web用户的password_hash：hash-password，从标准输入读取密码
+func hashPasswordCommand(args []string) error {
+	flags := flag.NewFlagSet("hash-password", flag.ExitOnError)
+	cost := flags.Int("cost", bcrypt.DefaultCost, "bcrypt cost")
+	flags.Parse(args)
+	password, err := readSecret("password")
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), *cost)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(hash))
+	return nil
+}
+
+//校验配置文件，列出所有问题，不启动项目
+func validateCommand(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.Parse(args)
+	file := conf.DefaultConfigFile()
+	if flags.NArg() > 0 {
+		file = flags.Arg(0)
+	}
+	config, err := conf.LoadConfig(file)
+	if err != nil {
+		return fmt.Errorf("load %s failed:%v", file, err)
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	fmt.Printf("%s: config ok, %d project(s)\n", file, len(config.Conf))
+	return nil
+}
+
+//管理加密密钥文件：vault set|delete|list，主密钥为环境变量AUTOSFTP_MASTER_KEY或-key-file的内容
+func vaultCommand(args []string) error {
+	flags := flag.NewFlagSet("vault", flag.ExitOnError)
+	file := flags.String("file", fmt.Sprintf("etc%ssecrets.vault", string(os.PathSeparator)), "vault file")
+	keyFile := flags.String("key-file", "", "master key file, used when $"+conf.MasterKeyEnv+" is not set")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vault [-file file] [-key-file file] set|delete|list [name]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	action, name := flags.Arg(0), flags.Arg(1)
+	if action != "list" && len(name) == 0 || action != "set" && action != "delete" && action != "list" {
+		flags.Usage()
+		return errors.New("invalid vault command")
+	}
+	key, err := conf.MasterKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	vault, err := conf.OpenVault(*file, key)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "list":
+		for _, name := range vault.Names() {
+			fmt.Println(name)
+		}
+		return nil
+	case "set":
+		secret, err := readSecret("secret")
+		if err != nil {
+			return err
+		}
+		vault.Set(name, secret)
+	case "delete":
+		if !vault.Delete(name) {
+			return fmt.Errorf("secret %s not found in %s", name, *file)
+		}
+	}
+	if err := vault.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s %s\n", *file, action, name)
+	return nil
+}
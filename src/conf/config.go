@@ -1,46 +1,147 @@
 package conf
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 )
 
 type Config struct {
+	BandwidthLimit int      `json:"bandwidth_limit"`  //所有项目共享的上传限速（KB/s），0表示不限速
+	ReloadInterval int      `json:"reload_interval"`  //检查配置文件是否修改的间隔（秒），默认5，小于0时只在收到SIGHUP时重新加载
+	Web *WebConfig          `json:"web"`
+	Log *LogConfig          `json:"log"`
+	Secrets *SecretsConfig  `json:"secrets"`
 	Conf []*ProjectConfig `json:"project"`
 }
 
+//日志配置，未配置时以text格式输出INFO及以上级别的日志到标准错误
+type LogConfig struct {
+	Level string            `json:"level"`      //debug、info（默认）、warn、error
+	Format string           `json:"format"`     //text（默认）、json
+	Output string           `json:"output"`     //stderr（默认）、stdout、file、syslog
+	File string             `json:"file"`       //output为file时的日志文件
+	SyslogNetwork string    `json:"syslog_network"` //udp、tcp，为空时连接本机的syslog
+	SyslogAddress string    `json:"syslog_address"`
+	SyslogTag string        `json:"syslog_tag"` //默认go-auto-sftp
+	MaxSize int             `json:"max_size"`   //output为file时，日志文件超过多少MB后轮转，0表示不按大小轮转
+	Rotate string           `json:"rotate"`     //按时间轮转：hourly、daily，为空时不按时间轮转
+	MaxBackups int          `json:"max_backups"` //保留的轮转文件数，0表示不限制
+	MaxAge int              `json:"max_age"`    //轮转文件保留的天数，0表示不限制
+	Compress bool           `json:"compress"`   //gzip压缩轮转后的文件
+	Buffer int              `json:"buffer"`     //日志队列长度，默认1024
+	Overflow string         `json:"overflow"`   //队列满时：drop（默认，丢弃并计数）、block（阻塞等待写入）
+}
+
+//web服务配置，tokens和users都为空时不认证
+type WebConfig struct {
+	Listen string           `json:"listen"`     //监听地址，默认127.0.0.1:8090
+	CertFile string         `json:"cert_file"`  //同时配置证书和私钥时启用https
+	KeyFile string          `json:"key_file"`
+	Tokens []*TokenConfig   `json:"tokens"`
+	Users []*UserConfig     `json:"users"`
+}
+
+//Authorization: Bearer <token>
+type TokenConfig struct {
+	Name string             `json:"name"`
+	Token Secret            `json:"token"`
+	Role string             `json:"role"`       //read（只读，默认）、admin（可同步、暂停等）
+}
+
+//HTTP basic认证
+type UserConfig struct {
+	User string             `json:"user"`
+	PasswordHash string     `json:"password_hash"` //bcrypt哈希，可用hash-password命令生成
+	Role string             `json:"role"`
+}
+
 type ProjectConfig struct {
 	Switch string           `json:"switch"`
 	Name string             `json:"name"`
 	User string             `json:"user"`
-	Passwd string           `json:"passwd"`
+	Passwd Secret           `json:"passwd"`          //密码，可引用环境变量、文件、命令或加密密钥文件中的密钥
 	LocalBaseDir string     `json:"local_base_dir"`
 	RemoteAddress string    `json:"remote_address"`
 	RemoteBaseDir string    `json:"remote_base_dir"`
 	SaveProject   string    `json:"save_project"`
+	SaveFormat string       `json:"save_format"`       //状态文件格式：json（默认）、binary
 	LocalOs  string         `json:"local_os"`
 	RemoteOs string         `json:"remote_os"`
+	RemoteHooks []*HookConfig `json:"remote_hooks"`
+	PreHooks []*HookConfig  `json:"pre_hooks"`
+	Transforms []*TransformConfig `json:"transforms"`
+	StripBaseDir bool       `json:"strip_base_dir"`  //远程路径中不包含本地基目录名
+	PathMappings []*PathMapping `json:"path_mappings"`
+	RenameRules []*RenameRule `json:"rename_rules"`
+	BandwidthLimit int      `json:"bandwidth_limit"`  //项目上传限速（KB/s），0表示不限速
+	TransferWindows []*TransferWindow `json:"transfer_windows"`
+	TransferWindowsOnly bool `json:"transfer_windows_only"` //只在传输窗口内上传，窗口外只检测变更
+	QuietPeriod int         `json:"quiet_period"`      //变更稳定多久（毫秒）后才上传，0表示检测到变更立即上传
+	MaxBatchDelay int       `json:"max_batch_delay"`   //变更持续不稳定时最多等待多久（毫秒）强制上传，0表示一直等待
+	ScanWorkers int         `json:"scan_workers"`      //并发扫描目录的goroutine数，小于等于1时顺序扫描
+	Mode string             `json:"mode"`              //检测模式：auto（默认）、manual、adaptive
+	CheckInterval int       `json:"check_interval"`    //检测间隔（毫秒），默认2000
+	MaxCheckInterval int    `json:"max_check_interval"` //adaptive模式下的最大检测间隔（毫秒），默认60000
+	SaveInterval int        `json:"save_interval"`     //保存状态文件的间隔（秒），默认1800
+	JournalFile string      `json:"journal_file"`      //传输日志文件，默认为save_project加.journal后缀，off表示不记录
+	JournalMaxSize int      `json:"journal_max_size"`  //传输日志文件的大小上限（MB），超过后轮转，默认10
+	JournalMaxFiles int     `json:"journal_max_files"` //保留的历史传输日志文件数，默认5
 }
 
+//按一天中的时间段控制上传，start大于end时表示跨越零点
+type TransferWindow struct {
+	Start string            `json:"start"`      //开始时间，如22:00
+	End string              `json:"end"`        //结束时间，如07:30
+	Pause bool              `json:"pause"`      //窗口内暂停上传，变更排队到窗口结束后上传
+	BandwidthLimit int      `json:"bandwidth_limit"`  //窗口内的上传限速（KB/s），0表示使用项目限速
+}
 
-func InitConfig() (*Config, error) {
-	config := new(Config)
-	configFile := fmt.Sprintf("etc%sproject.json", string(filepath.Separator))
+//将本地子目录映射到不同的远程根目录
+type PathMapping struct {
+	Local string            `json:"local"`      //本地相对路径（相对local_base_dir，以/分隔）
+	Remote string           `json:"remote"`     //对应的远程绝对路径
+}
+
+//通过正则表达式重命名远程路径
+type RenameRule struct {
+	Pattern string          `json:"pattern"`    //匹配相对路径（映射根目录之下，以/分隔）的正则表达式
+	Replace string          `json:"replace"`    //替换内容，支持$1等分组引用
+}
+
+//同步完成后执行的钩子命令
+type HookConfig struct {
+	Name string             `json:"name"`
+	Command string          `json:"command"`
+	Paths []string          `json:"paths"`      //变更路径匹配规则（相对local_base_dir，以/分隔），为空表示任意变更都执行
+	Timeout int             `json:"timeout"`    //超时时间（秒），0表示不限制
+	FailSync bool           `json:"fail_sync"`  //执行失败时是否将本次同步标记为失败
+}
+
+//上传前对单个文件的转换，转换结果代替原文件上传
+type TransformConfig struct {
+	Pattern string          `json:"pattern"`    //文件名匹配规则，如*.js
+	Type string             `json:"type"`       //转换类型：gzip、template、command
+	Suffix string           `json:"suffix"`     //远程文件名追加的后缀，如.gz
+	Vars map[string]string  `json:"vars"`       //template：占位符及替换值
+	Command string          `json:"command"`    //command：从标准输入读取原文件，标准输出作为转换结果
+	Timeout int             `json:"timeout"`    //command：超时时间（秒），默认60
+}
+
+
+//默认配置文件路径etc/project.json
+func DefaultConfigFile() string {
+	return fmt.Sprintf("etc%sproject.json", string(filepath.Separator))
+}
+
+//配置文件路径，默认DefaultConfigFile，可通过第一个命令行参数指定，支持json、yaml、toml格式
+func ConfigFile() string {
 	if len(os.Args) >= 2 && len(os.Args[1]) != 0 {
-		configFile = os.Args[1]
+		return os.Args[1]
 	}
-	fp, err := os.Open(configFile)
-	if err != nil {
-		return nil, err
-	}
-	defer fp.Close()
+	return DefaultConfigFile()
+}
 
-	decode := json.NewDecoder(fp)
-	err = decode.Decode(config)
-	if err != nil {
-		return nil, err
-	}
-	return config, nil
-}
\ No newline at end of file
+func InitConfig() (*Config, error) {
+	return LoadConfig(ConfigFile())
+}
@@ -0,0 +1,346 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//配置文件中不属于Config的顶层字段
+const (
+	keyDefaults = "defaults" //所有项目继承的默认配置，项目中的同名字段优先
+	keyInclude  = "include"  //引入的项目配置文件，支持通配符，相对路径相对于主配置文件所在目录
+	keyProject  = "project"
+)
+
+//${VAR}或${VAR:-default}，不处理$VAR，避免修改bcrypt哈希等包含$的值
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+//按扩展名解析为通用结构：.yaml、.yml、.toml，其他按json解析
+func decodeFile(file string) (interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		var m map[string]interface{}
+		err = toml.Unmarshal(data, &m)
+		doc = m
+	default:
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if doc, err = expandEnv(doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return doc, nil
+}
+
+//替换所有字符串值中的环境变量，变量未设置且没有默认值时报错
+func expandEnv(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var missing []string
+		s := envPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			m := envPattern.FindStringSubmatch(ref)
+			if env, ok := os.LookupEnv(m[1]); ok {
+				return env
+			}
+			if len(m[2]) == 0 {
+				missing = append(missing, m[1])
+			}
+			return m[3]
+		})
+		if len(missing) != 0 {
+			return nil, fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+		}
+		return s, nil
+	case map[string]interface{}:
+		for key, item := range v {
+			expanded, err := expandEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := expandEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	case []map[string]interface{}: //toml的表数组
+		for _, item := range v {
+			if _, err := expandEnv(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return value, nil
+}
+
+//环境变量展开后都是字符串，按解码目标的字段类型将字符串转换为数字或布尔值，
+//如bandwidth_limit: ${BW}，无法转换时保留原值，由解码时报错
+func convertTypes(value interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := value.(type) {
+	case string:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+				return n
+			}
+		case reflect.Float32, reflect.Float64:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		case reflect.Bool:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b
+			}
+		}
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for key, item := range v {
+				if field, ok := fields[key]; ok {
+					v[key] = convertTypes(item, field)
+				}
+			}
+		case reflect.Map:
+			for key, item := range v {
+				v[key] = convertTypes(item, t.Elem())
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, item := range v {
+				v[i] = convertTypes(item, t.Elem())
+			}
+		}
+	case []map[string]interface{}: //toml的表数组
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, item := range v {
+				convertTypes(item, t.Elem())
+			}
+		}
+	}
+	return value
+}
+
+//json字段名到字段类型
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func toMap(file string, doc interface{}) (map[string]interface{}, error) {
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expect an object at top level", file)
+	}
+	return m, nil
+}
+
+//项目列表统一为[]interface{}
+func toList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case []map[string]interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, item)
+		}
+		return list
+	}
+	return nil
+}
+
+//主配置文件引入的文件，按文件名排序
+func includeFiles(file string, doc map[string]interface{}) ([]string, error) {
+	var patterns []string
+	switch v := doc[keyInclude].(type) {
+	case nil:
+	case string:
+		patterns = []string{v}
+	default:
+		for _, p := range toList(v) {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: include must be a list of file patterns", file)
+			}
+			patterns = append(patterns, s)
+		}
+		if patterns == nil {
+			return nil, fmt.Errorf("%s: include must be a list of file patterns", file)
+		}
+	}
+	dir := filepath.Dir(file)
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include pattern %q: %v", file, pattern, err)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+//引入的文件可以是单个项目、项目列表，或包含project列表的对象
+func includedProjects(file string) ([]interface{}, error) {
+	doc, err := decodeFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if list := toList(doc); list != nil {
+		return list, nil
+	}
+	m, err := toMap(file, doc)
+	if err != nil {
+		return nil, err
+	}
+	if projects, ok := m[keyProject]; ok {
+		return toList(projects), nil
+	}
+	return []interface{}{m}, nil
+}
+
+//深度合并，project中的值覆盖defaults，列表整体覆盖
+func merge(defaults, project map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(defaults)+len(project))
+	for key, value := range defaults {
+		res[key] = value
+	}
+	for key, value := range project {
+		d, ok1 := res[key].(map[string]interface{})
+		p, ok2 := value.(map[string]interface{})
+		if ok1 && ok2 {
+			res[key] = merge(d, p)
+		}else{
+			res[key] = value
+		}
+	}
+	return res
+}
+
+//主配置文件及其引入的所有文件，用于检查配置是否修改
+func ConfigFiles(configFile string) ([]string, error) {
+	doc, err := decodeFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	m, err := toMap(configFile, doc)
+	if err != nil {
+		return nil, err
+	}
+	files, err := includeFiles(configFile, m)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{configFile}, files...), nil
+}
+
+//读取配置文件：按扩展名选择json、yaml、toml格式，展开环境变量，
+//加入include引入的项目，每个项目继承defaults，字符串按字段类型转换后按json字段解码，最后解析密钥引用
+func LoadConfig(configFile string) (*Config, error) {
+	doc, err := decodeFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	m, err := toMap(configFile, doc)
+	if err != nil {
+		return nil, err
+	}
+	var defaults map[string]interface{}
+	if d := m[keyDefaults]; d != nil {
+		var ok bool
+		if defaults, ok = d.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("%s: defaults must be an object", configFile)
+		}
+	}
+	projects := toList(m[keyProject])
+	if m[keyProject] != nil && projects == nil {
+		return nil, fmt.Errorf("%s: project must be a list", configFile)
+	}
+	files, err := includeFiles(configFile, m)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		list, err := includedProjects(file)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, list...)
+	}
+	for i, p := range projects {
+		project, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: project #%d must be an object", configFile, i)
+		}
+		projects[i] = merge(defaults, project)
+	}
+	delete(m, keyDefaults)
+	delete(m, keyInclude)
+	m[keyProject] = projects
+	convertTypes(m, reflect.TypeOf(Config{}))
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", configFile, err)
+	}
+	config := new(Config)
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", configFile, err)
+	}
+	if err := config.resolveSecrets(filepath.Dir(configFile)); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,182 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+//三种格式的同一份配置解析结果相同
+func TestLoadConfig_Formats(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"project.json": `{"bandwidth_limit": 100, "log": {"level": "debug"}, "project": [
+			{"switch": "on", "name": "web", "local_base_dir": "/src/web", "transfer_windows": [{"start": "22:00", "end": "07:00"}]}]}`,
+		"project.yaml": `
+bandwidth_limit: 100
+log:
+  level: debug
+project:
+  - switch: "on"
+    name: web
+    local_base_dir: /src/web
+    transfer_windows:
+      - start: "22:00"
+        end: "07:00"
+`,
+		"project.toml": `
+bandwidth_limit = 100
+[log]
+level = "debug"
+[[project]]
+switch = "on"
+name = "web"
+local_base_dir = "/src/web"
+[[project.transfer_windows]]
+start = "22:00"
+end = "07:00"
+`,
+	})
+	var expect *Config
+	for _, name := range []string{"project.json", "project.yaml", "project.toml"} {
+		config, err := LoadConfig(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if expect == nil {
+			expect = config
+			if len(config.Conf) != 1 || config.Conf[0].TransferWindows[0].End != "07:00" || config.Log.Level != "debug" {
+				t.Fatalf("unexpected config %+v", config)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(expect, config) {
+			t.Errorf("%s differs from project.json: %+v", name, config)
+		}
+	}
+}
+
+func TestLoadConfig_DefaultsIncludeEnv(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("AUTOSFTP_TEST_HOST", "10.0.0.8")
+	defer os.Unsetenv("AUTOSFTP_TEST_HOST")
+	writeFiles(t, dir, map[string]string{
+		"project.yaml": `
+include: conf.d/*
+defaults:
+  switch: "on"
+  user: deploy
+  local_os: linux
+  remote_os: linux
+  remote_address: ${AUTOSFTP_TEST_HOST}:22
+  check_interval: 1000
+  remote_hooks:
+    - command: reload
+web:
+  users:
+    - user: dev
+      password_hash: $2a$10$abc
+project:
+  - name: main
+    local_base_dir: /src/main
+    save_project: ${AUTOSFTP_TEST_DIR:-/var/lib}/main.save
+`,
+		"conf.d/b.toml": `
+name = "b"
+switch = "off"
+local_base_dir = "/src/b"
+remote_hooks = []
+`,
+		"conf.d/a.json": `[{"name": "a", "check_interval": 500}, {"name": "a2"}]`,
+	})
+	config, err := LoadConfig(filepath.Join(dir, "project.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range config.Conf {
+		names = append(names, p.Name)
+		if p.User != "deploy" || p.RemoteAddress != "10.0.0.8:22" || p.LocalOs != "linux" {
+			t.Errorf("project %s does not inherit defaults: %+v", p.Name, p)
+		}
+	}
+	if strings.Join(names, ",") != "main,a,a2,b" {
+		t.Fatalf("unexpected projects %v", names)
+	}
+	main, a, b := config.Conf[0], config.Conf[1], config.Conf[3]
+	if main.SaveProject != "/var/lib/main.save" || main.CheckInterval != 1000 || len(main.RemoteHooks) != 1 {
+		t.Errorf("main: %+v", main)
+	}
+	if a.CheckInterval != 500 || b.Switch != "off" || len(b.RemoteHooks) != 0 {
+		t.Errorf("project values should override defaults: a=%+v b=%+v", a, b)
+	}
+	if config.Web.Users[0].PasswordHash != "$2a$10$abc" {
+		t.Errorf("password hash changed: %s", config.Web.Users[0].PasswordHash)
+	}
+	files, err := ConfigFiles(filepath.Join(dir, "project.yaml"))
+	if err != nil || len(files) != 3 || filepath.Base(files[1]) != "a.json" {
+		t.Errorf("config files %v %v", files, err)
+	}
+
+	//环境变量展开后的字符串按字段类型转换，字符串字段保持不变
+	os.Setenv("AUTOSFTP_TEST_NUM", "1024")
+	os.Setenv("AUTOSFTP_TEST_BOOL", "true")
+	defer os.Unsetenv("AUTOSFTP_TEST_NUM")
+	defer os.Unsetenv("AUTOSFTP_TEST_BOOL")
+	writeFiles(t, dir, map[string]string{
+		"typed.yaml": `
+bandwidth_limit: ${AUTOSFTP_TEST_NUM}
+project:
+  - name: typed
+    passwd: ${AUTOSFTP_TEST_NUM}
+    strip_base_dir: ${AUTOSFTP_TEST_BOOL}
+    transfer_windows:
+      - start: "09:00"
+        end: "18:00"
+        bandwidth_limit: ${AUTOSFTP_TEST_NUM:-10}
+`,
+		"typed.toml": `
+bandwidth_limit = "${AUTOSFTP_TEST_NUM}"
+[[project]]
+name = "typed"
+passwd = "${AUTOSFTP_TEST_NUM}"
+strip_base_dir = "${AUTOSFTP_TEST_BOOL}"
+[[project.transfer_windows]]
+start = "09:00"
+end = "18:00"
+bandwidth_limit = "${AUTOSFTP_TEST_NUM}"
+`,
+	})
+	for _, file := range []string{"typed.yaml", "typed.toml"} {
+		typed, err := LoadConfig(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := typed.Conf[0]
+		if typed.BandwidthLimit != 1024 || p.Passwd != "1024" || !p.StripBaseDir || p.TransferWindows[0].BandwidthLimit != 1024 {
+			t.Errorf("%s: typed values %d %+v %+v", file, typed.BandwidthLimit, p, p.TransferWindows[0])
+		}
+	}
+	os.Setenv("AUTOSFTP_TEST_NUM", "1k")
+	if _, err := LoadConfig(filepath.Join(dir, "typed.yaml")); err == nil {
+		t.Error("expect decode error for non-numeric bandwidth_limit")
+	}
+
+	writeFiles(t, dir, map[string]string{"conf.d/c.yaml": "name: c\nuser: ${AUTOSFTP_TEST_MISSING}\n"})
+	if _, err := LoadConfig(filepath.Join(dir, "project.yaml")); err == nil || !strings.Contains(err.Error(), "c.yaml: environment variable AUTOSFTP_TEST_MISSING is not set") {
+		t.Errorf("expect missing variable error, got %v", err)
+	}
+}
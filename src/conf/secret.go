@@ -0,0 +1,266 @@
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+//主密钥的环境变量，优先于master_key_file
+const MasterKeyEnv = "AUTOSFTP_MASTER_KEY"
+
+const defaultSecretTimeout = 10 * time.Second
+
+//密钥引用的前缀，其他值按明文处理
+const (
+	secretEnv   = "env:"   //env:NAME，环境变量
+	secretFile  = "file:"  //file:PATH读取整个文件，file:PATH#KEY读取KEY=VALUE格式文件中的一项
+	secretCmd   = "cmd:"   //cmd:COMMAND，命令的标准输出
+	secretVault = "vault:" //vault:NAME，加密密钥文件中的一项
+	secretPlain = "plain:" //plain:VALUE，以上述前缀开头的明文
+)
+
+//敏感配置，通过fmt、日志、json输出时隐藏内容，使用时转换为string
+type Secret string
+
+const redacted = "******"
+
+func (s Secret) String() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+//密钥来源配置
+type SecretsConfig struct {
+	VaultFile string        `json:"vault_file"`      //加密密钥文件，用vault命令管理，相对路径相对于主配置文件所在目录
+	MasterKeyFile string    `json:"master_key_file"` //保存主密钥的文件，未设置环境变量AUTOSFTP_MASTER_KEY时使用
+	CommandTimeout int      `json:"command_timeout"` //cmd:命令的超时时间（秒），默认10
+}
+
+//解析配置中的密钥引用，同一次加载中文件和密钥文件只读取一次
+type secretResolver struct {
+	dir    string
+	config *SecretsConfig
+	files  map[string]map[string]string
+	vault  *Vault
+	err    error //打开密钥文件的错误
+}
+
+//相对路径相对于主配置文件所在目录
+func (r *secretResolver) path(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(r.dir, file)
+}
+
+func (r *secretResolver) resolve(s Secret) (Secret, error) {
+	value := string(s)
+	switch {
+	case strings.HasPrefix(value, secretEnv):
+		name := strings.TrimPrefix(value, secretEnv)
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return Secret(env), nil
+	case strings.HasPrefix(value, secretFile):
+		return r.file(strings.TrimPrefix(value, secretFile))
+	case strings.HasPrefix(value, secretCmd):
+		return r.command(strings.TrimPrefix(value, secretCmd))
+	case strings.HasPrefix(value, secretVault):
+		return r.fromVault(strings.TrimPrefix(value, secretVault))
+	case strings.HasPrefix(value, secretPlain):
+		return Secret(strings.TrimPrefix(value, secretPlain)), nil
+	}
+	return s, nil
+}
+
+func (r *secretResolver) file(ref string) (Secret, error) {
+	file, key := ref, ""
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		file, key = ref[:i], ref[i+1:]
+	}
+	file = r.path(file)
+	if err := CheckSecretFile(file); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if len(key) == 0 {
+		return Secret(strings.TrimRight(string(data), "\r\n")), nil
+	}
+	values, ok := r.files[file]
+	if !ok {
+		values = parseSecretFile(data)
+		r.files[file] = values
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in %s", key, file)
+	}
+	return Secret(value), nil
+}
+
+//KEY=VALUE格式，忽略空行和#开头的注释
+func parseSecretFile(data []byte) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, "="); i > 0 {
+			values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return values
+}
+
+//密钥文件只能由所有者访问，windows不检查
+func CheckSecretFile(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s is accessible by other users (mode %04o), run chmod 600 %s", file, info.Mode().Perm(), file)
+	}
+	return nil
+}
+
+//通过系统shell执行命令，去掉标准输出末尾的换行作为密钥，
+//命令行中可能包含密钥，错误中只包含退出状态和标准错误
+func (r *secretResolver) command(line string) (Secret, error) {
+	timeout := defaultSecretTimeout
+	if r.config != nil && r.config.CommandTimeout > 0 {
+		timeout = time.Duration(r.config.CommandTimeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", line)
+	}else{
+		cmd = exec.CommandContext(ctx, "sh", "-c", line)
+	}
+	cmd.Dir = r.dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("command failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return Secret(strings.TrimRight(string(out), "\r\n")), nil
+}
+
+func (r *secretResolver) fromVault(name string) (Secret, error) {
+	if r.vault == nil && r.err == nil {
+		r.vault, r.err = r.openVault()
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+	value, ok := r.vault.Get(name)
+	if !ok {
+		return "", fmt.Errorf("secret %s not found in vault %s", name, r.vault.file)
+	}
+	return Secret(value), nil
+}
+
+func (r *secretResolver) openVault() (*Vault, error) {
+	if r.config == nil || len(r.config.VaultFile) == 0 {
+		return nil, fmt.Errorf("secrets.vault_file is not configured")
+	}
+	keyFile := r.config.MasterKeyFile
+	if len(keyFile) != 0 {
+		keyFile = r.path(keyFile)
+	}
+	key, err := MasterKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	file := r.path(r.config.VaultFile)
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+	return OpenVault(file, key)
+}
+
+//主密钥：环境变量AUTOSFTP_MASTER_KEY，或keyFile的内容
+func MasterKey(keyFile string) (string, error) {
+	if key := os.Getenv(MasterKeyEnv); len(key) != 0 {
+		return key, nil
+	}
+	if len(keyFile) == 0 {
+		return "", fmt.Errorf("master key is not set, set %s or secrets.master_key_file", MasterKeyEnv)
+	}
+	if err := CheckSecretFile(keyFile); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimRight(string(data), "\r\n")
+	if len(key) == 0 {
+		return "", fmt.Errorf("master key file %s is empty", keyFile)
+	}
+	return key, nil
+}
+
+//替换web token和开启的项目密码中的密钥引用，一次返回所有无法解析的密钥
+func (c *Config) resolveSecrets(dir string) error {
+	r := &secretResolver{dir: dir, config: c.Secrets, files: make(map[string]map[string]string)}
+	var errs ValidationError
+	resolve := func(project, field string, s *Secret) {
+		value, err := r.resolve(*s)
+		if err != nil {
+			errs = append(errs, &FieldError{Project: project, Field: field, Message: err.Error()})
+			return
+		}
+		*s = value
+	}
+	if c.Web != nil {
+		for i, t := range c.Web.Tokens {
+			resolve("", fmt.Sprintf("web.tokens[%d].token", i), &t.Token)
+		}
+	}
+	//关闭的项目不使用密码，不解析
+	for i, p := range c.Conf {
+		if p == nil || p.Switch != "on" {
+			continue
+		}
+		name := p.Name
+		if len(name) == 0 {
+			name = fmt.Sprintf("#%d", i)
+		}
+		resolve(name, "passwd", &p.Passwd)
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSecret_Redacted(t *testing.T) {
+	p := &ProjectConfig{Name: "web", Passwd: "s3cret"}
+	data, _ := json.Marshal(p)
+	for _, out := range []string{fmt.Sprint(*p), fmt.Sprintf("%+v", *p), fmt.Sprintf("%#v", *p), string(data)} {
+		if strings.Contains(out, "s3cret") || !strings.Contains(out, redacted) {
+			t.Errorf("secret not redacted: %s", out)
+		}
+	}
+	if string(p.Passwd) != "s3cret" {
+		t.Errorf("secret value changed: %s", string(p.Passwd))
+	}
+}
+
+func TestLoadConfig_Secrets(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("AUTOSFTP_TEST_PASSWD", "from-env")
+	os.Setenv(MasterKeyEnv, "master")
+	defer os.Unsetenv("AUTOSFTP_TEST_PASSWD")
+	defer os.Unsetenv(MasterKeyEnv)
+	vault, err := OpenVault(filepath.Join(dir, "secrets.vault"), "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.Set("deploy", "from-vault")
+	if err := vault.Save(); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		"secrets.env": "# deploy passwords\nWEB = from-file\n",
+		"passwd.txt":  "whole-file\n",
+		"project.yaml": `
+secrets:
+  vault_file: secrets.vault
+web:
+  tokens:
+    - token: env:AUTOSFTP_TEST_PASSWD
+defaults:
+  switch: "on"
+project:
+  - {name: env, passwd: "env:AUTOSFTP_TEST_PASSWD"}
+  - {name: file, passwd: "file:secrets.env#WEB"}
+  - {name: whole, passwd: "file:passwd.txt"}
+  - {name: cmd, passwd: "cmd:echo from-cmd"}
+  - {name: vault, passwd: "vault:deploy"}
+  - {name: plain, passwd: "plain:env:literal"}
+  - {name: old, passwd: "literal"}
+  - {name: off, switch: "off", passwd: "cmd:exit 1"}
+`,
+	})
+	os.Chmod(filepath.Join(dir, "secrets.env"), 0600)
+	os.Chmod(filepath.Join(dir, "passwd.txt"), 0600)
+	config, err := LoadConfig(filepath.Join(dir, "project.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"from-env", "from-file", "whole-file", "from-cmd", "from-vault", "env:literal", "literal", "cmd:exit 1"}
+	for i, p := range config.Conf {
+		if string(p.Passwd) != expect[i] {
+			t.Errorf("project %s passwd %q, expect %q", p.Name, string(p.Passwd), expect[i])
+		}
+	}
+	if string(config.Web.Tokens[0].Token) != "from-env" {
+		t.Errorf("token %q", string(config.Web.Tokens[0].Token))
+	}
+
+	//所有无法解析的密钥一次报告，错误中不包含密钥内容
+	if runtime.GOOS != "windows" {
+		os.Chmod(filepath.Join(dir, "secrets.env"), 0644)
+	}
+	os.Unsetenv("AUTOSFTP_TEST_PASSWD")
+	os.Setenv(MasterKeyEnv, "wrong")
+	_, err = LoadConfig(filepath.Join(dir, "project.yaml"))
+	errs, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expect ValidationError, got %v", err)
+	}
+	msg := err.Error()
+	for _, e := range []string{
+		"web.tokens[0].token: environment variable AUTOSFTP_TEST_PASSWD is not set",
+		"project[env] passwd: environment variable AUTOSFTP_TEST_PASSWD is not set",
+		"project[vault] passwd: " + ErrVaultKey.Error(),
+	} {
+		if !strings.Contains(msg, e) {
+			t.Errorf("missing error %q in\n%s", e, msg)
+		}
+	}
+	if runtime.GOOS != "windows" && !strings.Contains(msg, "project[file] passwd: ") {
+		t.Errorf("expect permission error in\n%s", msg)
+	}
+	if strings.Contains(msg, "project[off]") || strings.Contains(msg, "from-") {
+		t.Errorf("unexpected error content:\n%s", msg)
+	}
+	if len(errs) < 3 {
+		t.Errorf("got %d errors", len(errs))
+	}
+}
+
+//命令行中可能包含密钥，执行失败时只报告退出状态和标准错误
+func TestSecretResolver_CommandError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh not available")
+	}
+	r := &secretResolver{dir: t.TempDir()}
+	_, err := r.command("echo denied >&2; exit 3 # token=hunter2")
+	if err == nil {
+		t.Fatal("expect command error")
+	}
+	if msg := err.Error(); strings.Contains(msg, "hunter2") || !strings.Contains(msg, "exit status 3") || !strings.Contains(msg, "denied") {
+		t.Errorf("command error %q", msg)
+	}
+}
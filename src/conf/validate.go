@@ -0,0 +1,354 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//配置中的一个问题，project为空时是全局配置
+type FieldError struct {
+	Project string
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if len(e.Project) == 0 {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return fmt.Sprintf("project[%s] %s: %s", e.Project, e.Field, e.Message)
+}
+
+//校验发现的所有问题
+type ValidationError []*FieldError
+
+func (v ValidationError) Error() string {
+	lines := make([]string, 0, len(v)+1)
+	lines = append(lines, fmt.Sprintf("%d config error(s):", len(v)))
+	for _, e := range v {
+		lines = append(lines, "  "+e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+//可选值，空值表示默认
+var (
+	validOs         = []string{"windows", "linux", "mac"}
+	validSwitch     = []string{"", "on", "off"}
+	validMode       = []string{"", "auto", "manual", "adaptive"}
+	validSaveFormat = []string{"", "json", "binary"}
+	validTransform  = []string{"gzip", "template", "command"}
+	validRole       = []string{"", "read", "admin"}
+	validLogLevel   = []string{"", "debug", "info", "warn", "warning", "error"}
+	validLogFormat  = []string{"", "text", "json"}
+	validLogOutput  = []string{"", "stdout", "stderr", "file", "syslog"}
+	validLogRotate  = []string{"", "hourly", "daily"}
+	validOverflow   = []string{"", "drop", "block"}
+	validNetwork    = []string{"", "udp", "tcp", "unix", "unixgram"}
+)
+
+var windowsAbs = regexp.MustCompile(`^([A-Za-z]:[\\/]|\\\\)`)
+
+type validator struct {
+	errs    ValidationError
+	project string
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, &FieldError{Project: v.project, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field, value string) bool {
+	if len(strings.TrimSpace(value)) == 0 {
+		v.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+//值区分大小写，与运行时的比较一致
+func (v *validator) oneOf(field, value string, valid []string) {
+	for _, s := range valid {
+		if s == value {
+			return
+		}
+	}
+	for _, s := range valid {
+		if strings.EqualFold(s, value) {
+			v.add(field, "invalid value %q, values are case-sensitive, use %q", value, s)
+			return
+		}
+	}
+	v.invalid(field, value, valid)
+}
+
+//运行时不区分大小写的值，如操作系统和日志配置
+func (v *validator) oneOfFold(field, value string, valid []string) {
+	for _, s := range valid {
+		if strings.EqualFold(s, value) {
+			return
+		}
+	}
+	v.invalid(field, value, valid)
+}
+
+func (v *validator) invalid(field, value string, valid []string) {
+	names := make([]string, 0, len(valid))
+	for _, s := range valid {
+		if len(s) != 0 {
+			names = append(names, s)
+		}
+	}
+	v.add(field, "invalid value %q, expect one of %s", value, strings.Join(names, ", "))
+}
+
+func (v *validator) nonNegative(field string, value int) {
+	if value < 0 {
+		v.add(field, "must not be negative, got %d", value)
+	}
+}
+
+//host:port，port为1-65535
+func (v *validator) address(field, value string) {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		v.add(field, "invalid address %q, expect host:port", value)
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		v.add(field, "invalid port %q in %q", port, value)
+	}
+	if field != "web.listen" && len(host) == 0 {
+		v.add(field, "host is required in %q", value)
+	}
+}
+
+//按操作系统判断是否为绝对路径，os无效时不判断
+func (v *validator) absolute(field, value, os string) {
+	switch strings.ToLower(os) {
+	case "windows":
+		if !windowsAbs.MatchString(value) {
+			v.add(field, "%q is not an absolute windows path", value)
+		}
+	case "linux", "mac":
+		if !strings.HasPrefix(value, "/") {
+			v.add(field, "%q is not an absolute path", value)
+		}
+	}
+}
+
+//检查所有配置项，返回包含全部问题的ValidationError，没有问题时返回nil
+func (c *Config) Validate() error {
+	v := new(validator)
+	v.nonNegative("bandwidth_limit", c.BandwidthLimit)
+	if c.Web != nil {
+		v.validateWeb(c.Web)
+	}
+	if c.Log != nil {
+		v.validateLog(c.Log)
+	}
+	if c.Secrets != nil {
+		v.nonNegative("secrets.command_timeout", c.Secrets.CommandTimeout)
+	}
+	names := make(map[string]int)
+	for i, p := range c.Conf {
+		if p == nil {
+			v.project = ""
+			v.add(fmt.Sprintf("project[%d]", i), "is empty")
+			continue
+		}
+		v.project = p.Name
+		if len(p.Name) == 0 {
+			v.project = fmt.Sprintf("#%d", i)
+		}
+		if j, ok := names[p.Name]; ok && len(p.Name) != 0 {
+			v.add("name", "duplicate project name, also used by project #%d", j)
+		}else{
+			names[p.Name] = i
+		}
+		v.validateProject(p)
+	}
+	v.project = ""
+	v.validateEnabled(c.Conf)
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func (v *validator) validateProject(p *ProjectConfig) {
+	v.required("name", p.Name)
+	v.oneOf("switch", p.Switch, validSwitch)
+	if v.required("local_os", p.LocalOs) {
+		v.oneOfFold("local_os", p.LocalOs, validOs)
+	}
+	if v.required("remote_os", p.RemoteOs) {
+		v.oneOfFold("remote_os", p.RemoteOs, validOs)
+	}
+	if v.required("local_base_dir", p.LocalBaseDir) {
+		v.absolute("local_base_dir", p.LocalBaseDir, p.LocalOs)
+	}
+	if v.required("remote_base_dir", p.RemoteBaseDir) {
+		v.absolute("remote_base_dir", p.RemoteBaseDir, p.RemoteOs)
+	}
+	if v.required("remote_address", p.RemoteAddress) {
+		v.address("remote_address", p.RemoteAddress)
+	}
+	v.required("user", p.User)
+	v.required("save_project", p.SaveProject)
+	v.oneOf("save_format", p.SaveFormat, validSaveFormat)
+	v.oneOf("mode", p.Mode, validMode)
+	v.nonNegative("bandwidth_limit", p.BandwidthLimit)
+	v.nonNegative("quiet_period", p.QuietPeriod)
+	v.nonNegative("max_batch_delay", p.MaxBatchDelay)
+	v.nonNegative("scan_workers", p.ScanWorkers)
+	v.nonNegative("check_interval", p.CheckInterval)
+	v.nonNegative("max_check_interval", p.MaxCheckInterval)
+	v.nonNegative("save_interval", p.SaveInterval)
+	v.nonNegative("journal_max_size", p.JournalMaxSize)
+	v.nonNegative("journal_max_files", p.JournalMaxFiles)
+	for i, h := range p.RemoteHooks {
+		v.validateHook(fmt.Sprintf("remote_hooks[%d]", i), h)
+	}
+	for i, h := range p.PreHooks {
+		v.validateHook(fmt.Sprintf("pre_hooks[%d]", i), h)
+	}
+	for i, t := range p.Transforms {
+		field := fmt.Sprintf("transforms[%d]", i)
+		if v.required(field+".pattern", t.Pattern) {
+			if _, err := path.Match(t.Pattern, ""); err != nil {
+				v.add(field+".pattern", "invalid pattern %q: %v", t.Pattern, err)
+			}
+		}
+		if v.required(field+".type", t.Type) {
+			v.oneOf(field+".type", t.Type, validTransform)
+		}
+		if t.Type == "command" {
+			v.required(field+".command", t.Command)
+		}
+		v.nonNegative(field+".timeout", t.Timeout)
+	}
+	for i, m := range p.PathMappings {
+		field := fmt.Sprintf("path_mappings[%d]", i)
+		v.required(field+".local", m.Local)
+		if v.required(field+".remote", m.Remote) {
+			v.absolute(field+".remote", m.Remote, p.RemoteOs)
+		}
+	}
+	for i, r := range p.RenameRules {
+		field := fmt.Sprintf("rename_rules[%d].pattern", i)
+		if v.required(field, r.Pattern) {
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				v.add(field, "invalid regexp %q: %v", r.Pattern, err)
+			}
+		}
+	}
+	for i, w := range p.TransferWindows {
+		field := fmt.Sprintf("transfer_windows[%d]", i)
+		if _, err := time.Parse("15:04", w.Start); err != nil {
+			v.add(field+".start", "invalid time %q, expect HH:MM", w.Start)
+		}
+		if _, err := time.Parse("15:04", w.End); err != nil {
+			v.add(field+".end", "invalid time %q, expect HH:MM", w.End)
+		}
+		v.nonNegative(field+".bandwidth_limit", w.BandwidthLimit)
+	}
+}
+
+func (v *validator) validateHook(field string, h *HookConfig) {
+	v.required(field+".command", h.Command)
+	v.nonNegative(field+".timeout", h.Timeout)
+}
+
+func (v *validator) validateWeb(w *WebConfig) {
+	if len(w.Listen) != 0 {
+		v.address("web.listen", w.Listen)
+	}
+	if (len(w.CertFile) == 0) != (len(w.KeyFile) == 0) {
+		v.add("web.cert_file", "cert_file and key_file must be set together")
+	}
+	tokens := make(map[Secret]bool)
+	for i, t := range w.Tokens {
+		field := fmt.Sprintf("web.tokens[%d]", i)
+		if v.required(field+".token", string(t.Token)) {
+			if tokens[t.Token] {
+				v.add(field+".token", "duplicate token")
+			}
+			tokens[t.Token] = true
+		}
+		v.oneOf(field+".role", t.Role, validRole)
+	}
+	users := make(map[string]bool)
+	for i, u := range w.Users {
+		field := fmt.Sprintf("web.users[%d]", i)
+		if v.required(field+".user", u.User) {
+			if users[u.User] {
+				v.add(field+".user", "duplicate user %q", u.User)
+			}
+			users[u.User] = true
+		}
+		if v.required(field+".password_hash", u.PasswordHash) && !strings.HasPrefix(u.PasswordHash, "$2") {
+			v.add(field+".password_hash", "is not a bcrypt hash, generate it with the hash-password command")
+		}
+		v.oneOf(field+".role", u.Role, validRole)
+	}
+}
+
+func (v *validator) validateLog(l *LogConfig) {
+	v.oneOfFold("log.level", l.Level, validLogLevel)
+	v.oneOfFold("log.format", l.Format, validLogFormat)
+	v.oneOfFold("log.output", l.Output, validLogOutput)
+	v.oneOfFold("log.rotate", l.Rotate, validLogRotate)
+	v.oneOfFold("log.overflow", l.Overflow, validOverflow)
+	v.oneOf("log.syslog_network", l.SyslogNetwork, validNetwork)
+	if strings.EqualFold(l.Output, "file") {
+		v.required("log.file", l.File)
+	}
+	v.nonNegative("log.max_size", l.MaxSize)
+	v.nonNegative("log.max_backups", l.MaxBackups)
+	v.nonNegative("log.max_age", l.MaxAge)
+	v.nonNegative("log.buffer", l.Buffer)
+}
+
+//开启的项目之间不能使用同一个状态文件，本地目录不能重叠（否则同一文件由两个项目上传）
+func (v *validator) validateEnabled(projects []*ProjectConfig) {
+	enabled := make([]*ProjectConfig, 0, len(projects))
+	for _, p := range projects {
+		if p != nil && p.Switch == "on" {
+			enabled = append(enabled, p)
+		}
+	}
+	for i, a := range enabled {
+		for _, b := range enabled[i+1:] {
+			v.project = b.Name
+			if len(a.SaveProject) != 0 && samePath(a.SaveProject, b.SaveProject, a.LocalOs) {
+				v.add("save_project", "%q is also used by project %s", b.SaveProject, a.Name)
+			}
+			if len(a.LocalBaseDir) != 0 && len(b.LocalBaseDir) != 0 && overlap(a.LocalBaseDir, b.LocalBaseDir, a.LocalOs) {
+				v.add("local_base_dir", "%q overlaps local_base_dir %q of project %s", b.LocalBaseDir, a.LocalBaseDir, a.Name)
+			}
+		}
+	}
+}
+
+//windows路径不区分大小写，分隔符统一为/
+func normalize(p, os string) string {
+	if strings.EqualFold(os, "windows") {
+		p = strings.ToLower(strings.Replace(p, "\\", "/", -1))
+	}
+	return strings.TrimRight(p, "/")
+}
+
+func samePath(a, b, os string) bool {
+	return normalize(a, os) == normalize(b, os)
+}
+
+func overlap(a, b, os string) bool {
+	a, b = normalize(a, os)+"/", normalize(b, os)+"/"
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
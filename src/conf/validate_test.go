@@ -0,0 +1,87 @@
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func validProject(name, dir string) *ProjectConfig {
+	return &ProjectConfig{
+		Switch:        "on",
+		Name:          name,
+		User:          "deploy",
+		LocalOs:       "linux",
+		RemoteOs:      "linux",
+		LocalBaseDir:  dir,
+		RemoteBaseDir: "/var/www",
+		RemoteAddress: "10.0.0.1:22",
+		SaveProject:   "/var/lib/autosftp/" + name + ".save",
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	config := &Config{Conf: []*ProjectConfig{validProject("a", "/src/a"), validProject("b", "/src/b")}}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	win := validProject("win", `E:\workspace\go`)
+	win.LocalOs = "Windows"
+	bad := validProject("bad", "relative/dir")
+	bad.LocalOs = "solaris"
+	bad.RemoteOs = ""
+	bad.RemoteAddress = "10.0.0.1"
+	bad.Mode = "fast"
+	bad.Switch = "ON"
+	bad.SaveFormat = "Binary"
+	bad.Transforms = []*TransformConfig{{Pattern: "*.js", Type: "GZIP"}}
+	bad.RenameRules = []*RenameRule{{Pattern: "("}}
+	bad.TransferWindows = []*TransferWindow{{Start: "25:00", End: "07:00"}}
+	dupSave := validProject("dup", "/src/a/sub")
+	dupSave.SaveProject = "/var/lib/autosftp/a.save"
+	config = &Config{
+		Web: &WebConfig{Listen: ":http", CertFile: "server.crt", Users: []*UserConfig{{User: "dev", PasswordHash: "secret"}}},
+		Log: &LogConfig{Output: "file"},
+		Conf: []*ProjectConfig{validProject("a", "/src/a"), win, bad, dupSave, validProject("a", "/src/c"), {Name: ""}},
+	}
+	err := config.Validate()
+	errs, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expect ValidationError, got %v", err)
+	}
+	expect := []string{
+		`web.listen: invalid port "http"`,
+		`web.cert_file: cert_file and key_file must be set together`,
+		`web.users[0].password_hash: is not a bcrypt hash`,
+		`log.file: is required`,
+		`project[bad] local_os: invalid value "solaris"`,
+		`project[bad] remote_os: is required`,
+		`project[bad] remote_address: invalid address "10.0.0.1"`,
+		`project[bad] mode: invalid value "fast"`,
+		`project[bad] switch: invalid value "ON", values are case-sensitive, use "on"`,
+		`project[bad] save_format: invalid value "Binary", values are case-sensitive, use "binary"`,
+		`project[bad] transforms[0].type: invalid value "GZIP", values are case-sensitive, use "gzip"`,
+		`project[bad] rename_rules[0].pattern: invalid regexp "("`,
+		`project[bad] transfer_windows[0].start: invalid time "25:00"`,
+		`project[a] name: duplicate project name`,
+		`project[#5] name: is required`,
+		`project[#5] local_base_dir: is required`,
+		`project[dup] save_project: "/var/lib/autosftp/a.save" is also used by project a`,
+		`project[dup] local_base_dir: "/src/a/sub" overlaps local_base_dir "/src/a" of project a`,
+	}
+	msg := err.Error()
+	for _, e := range expect {
+		if !strings.Contains(msg, e) {
+			t.Errorf("missing error %q", e)
+		}
+	}
+	if strings.Contains(msg, "project[win]") {
+		t.Errorf("windows project should be valid:\n%s", msg)
+	}
+	if strings.Contains(msg, "project[bad] local_base_dir") {
+		t.Errorf("absolute path is not checked when os is invalid:\n%s", msg)
+	}
+	if len(errs) < len(expect) {
+		t.Errorf("got %d errors:\n%s", len(errs), msg)
+	}
+}
@@ -0,0 +1,146 @@
+package conf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+const vaultVersion = 1
+
+//scrypt参数
+const (
+	vaultKdfN   = 1 << 15
+	vaultKdfR   = 8
+	vaultKdfP   = 1
+	vaultKeyLen = 32
+)
+
+var ErrVaultKey = errors.New("vault: wrong master key or corrupted file")
+
+//加密的密钥文件：用主密钥经scrypt派生的密钥以AES-256-GCM加密名称到密钥的映射
+type vaultFile struct {
+	Version int    `json:"version"`
+	Kdf     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+//解密后的密钥文件
+type Vault struct {
+	file    string
+	key     string
+	secrets map[string]string
+}
+
+//打开密钥文件，文件不存在时返回空的Vault，保存时创建
+func OpenVault(file, masterKey string) (*Vault, error) {
+	if len(masterKey) == 0 {
+		return nil, errors.New("vault: master key is empty")
+	}
+	v := &Vault{file: file, key: masterKey, secrets: make(map[string]string)}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f vaultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("vault %s: %v", file, err)
+	}
+	if f.Version != vaultVersion || f.Kdf != "scrypt" {
+		return nil, fmt.Errorf("vault %s: unsupported version %d kdf %s", file, f.Version, f.Kdf)
+	}
+	gcm, err := vaultCipher(masterKey, f.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, ErrVaultKey
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, ErrVaultKey
+	}
+	if err := json.Unmarshal(plain, &v.secrets); err != nil {
+		return nil, fmt.Errorf("vault %s: %v", file, err)
+	}
+	return v, nil
+}
+
+func vaultCipher(masterKey string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(masterKey), salt, vaultKdfN, vaultKdfR, vaultKdfP, vaultKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (v *Vault) Get(name string) (string, bool) {
+	s, ok := v.secrets[name]
+	return s, ok
+}
+
+func (v *Vault) Set(name, secret string) {
+	v.secrets[name] = secret
+}
+
+func (v *Vault) Delete(name string) bool {
+	_, ok := v.secrets[name]
+	delete(v.secrets, name)
+	return ok
+}
+
+//按名称排序，不包含密钥内容
+func (v *Vault) Names() []string {
+	names := make([]string, 0, len(v.secrets))
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//每次保存使用新的salt和nonce，先写临时文件再替换，文件权限为0600
+func (v *Vault) Save() error {
+	plain, err := json.Marshal(v.secrets)
+	if err != nil {
+		return err
+	}
+	f := vaultFile{Version: vaultVersion, Kdf: "scrypt", Salt: make([]byte, 16)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	gcm, err := vaultCipher(v.key, f.Salt)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, plain, nil)
+	data, err := json.MarshalIndent(&f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := v.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, v.file)
+}
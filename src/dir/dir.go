@@ -7,7 +7,10 @@ import (
 	"os"
 	"path/filepath"
 	"sftp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +23,22 @@ const (
 	ShiftDelete      //彻底删除文件（缓存记录）
 )
 
+var statusName = map[int]string{
+	NotModify:   "NotModify",
+	Modify:      "Modify",
+	Add:         "Add",
+	Delete:      "Delete",
+	ShiftDelete: "ShiftDelete",
+}
+
+//返回状态名称
+func StatusName(status int) string {
+	if name, ok := statusName[status]; ok {
+		return name
+	}
+	return fmt.Sprint("Unknown(", status, ")")
+}
+
 const (
 	prefixSkipFile = "skip_"   //被忽略的文件
 	defaultSliceLength = 50
@@ -29,6 +48,10 @@ const (
 type Directory struct {
 	DirMap     map[string]*DirectoryStruct
 	Dir        *DirectoryStruct
+	workers    int
+	name       string              //项目名称，用于指标
+	scan       uint64              //CheckModify的轮次
+	writeCheck bool                //只上传最近一轮检测中没有变化的文件
 }
 
 func New() *Directory{
@@ -44,14 +67,41 @@ type DirectoryStruct struct {
 	DirChild []*DirectoryStruct        `json:"dir_child"`           //目录包含的子目录
 	File []*FileStruct                 `json:"file"`                //目录包含的非目录文件
 	Status int                         `json:"dir_status"`          //目录当前的存在状态
+	Inode uint64                       `json:"dir_inode,omitempty"` //目录的inode编号，用于重命名检测
 	ExistFile map[string]bool          `json:"-"`                   //文件存在状态，与ExistFlag一起校验对应文件是否存在
 	ExistFlag bool                     `json:"-"`                   //文件存在状态值，true和false
+	ChangeTime time.Time               `json:"-"`                   //最近一次检测到目录内发生变更的时间
+	stale bool                                                       //删除前仍有未同步的变更，远程内容与记录不一致
+	files map[string]*FileStruct                                     //文件名到File的索引，与File保持一致
 }
 
 type FileStruct struct {
 	Name string `json:"name"`
 	ModifyTime time.Time `json:"modify_time"`
+	Size int64 `json:"size"`
+	Inode uint64 `json:"inode,omitempty"`
 	Status int  `json:"file_status"`
+	stale bool
+	sized bool                                                       //Size来自扫描结果，旧状态文件中没有记录大小时为false
+	changeScan uint64                                                //最近一次检测到变化的轮次，0表示首次遍历或从状态文件读取
+}
+
+//按文件名查找目录下的文件，索引不存在时根据File重建
+func (dir *DirectoryStruct) lookupFile(name string) *FileStruct {
+	if dir.files == nil {
+		dir.files = make(map[string]*FileStruct, len(dir.File))
+		for _, file := range dir.File {
+			dir.files[filepath.Base(file.Name)] = file
+		}
+	}
+	return dir.files[name]
+}
+
+func (dir *DirectoryStruct) addFile(file *FileStruct) {
+	dir.File = append(dir.File, file)
+	if dir.files != nil {
+		dir.files[filepath.Base(file.Name)] = file
+	}
 }
 
 func (d *Directory) EncodeJson(w io.Writer) error {
@@ -71,30 +121,145 @@ func (d *Directory) DecodeJson(r io.Reader) error {
 	return nil
 }
 
+//设置扫描目录的并发数，小于等于1时顺序扫描
+func (d *Directory) SetScanWorkers(workers int) {
+	d.workers = workers
+}
+
+//开启后检测到变化的文件至少再经过一轮检测、大小和修改时间都没有变化才上传，避免上传写入中的文件，
+//未上传的文件保持变更状态，目录在下一轮检测时再次返回
+func (d *Directory) SetWriteCheck(enabled bool) {
+	d.writeCheck = enabled
+}
+
+//文件在最近一轮检测中没有变化
+func (d *Directory) settled(file *FileStruct) bool {
+	return !d.writeCheck || file.changeScan == 0 || file.changeScan < d.scan
+}
+
 func (d *Directory) Open(dir string) error {
-	return traversalDir(dir, d.Dir, d.DirMap)
+	return newScanner(d.DirMap, d.workers, 0).traversalDir(dir, d.Dir)
 }
 
 func (d *Directory) CheckModify() ([]string, error){
-	return checkDirModify(d.Dir, d.DirMap)
+	start := time.Now()
+	d.scan++
+	s := newScanner(d.DirMap, d.workers, d.scan)
+	modify, err := s.checkDirModify(d.Dir)
+	scansTotal.Inc(d.name)
+	scanDuration.Observe(time.Since(start).Seconds(), d.name)
+	if err != nil {
+		scanFailures.Inc(d.name)
+		return modify, err
+	}
+	changesDetected.Add(float64(s.changes.add), d.name, "add")
+	changesDetected.Add(float64(s.changes.modify), d.name, "modify")
+	changesDetected.Add(float64(s.changes.delete), d.name, "delete")
+	return modify, nil
 }
 
-func (d *Directory) Upload(client sftp.Sftp, localBaseDir,remoteBaseDir,localSep, remoteSep string, modify []string) error {
+//返回变更目录中最近一次检测到变更的时间，用于判断变更是否已经稳定
+func (d *Directory) LastChange(modify []string) time.Time {
+	var last time.Time
 	for _, path := range modify {
-		dir := d.DirMap[path]
-		if dir.Status == NotModify {
+		if dir, ok := d.DirMap[path]; ok && dir.ChangeTime.After(last) {
+			last = dir.ChangeTime
+		}
+	}
+	return last
+}
+
+//本地路径到远程路径的映射
+type PathMapper interface {
+	Remote(local string) string
+}
+
+//返回本次已同步到远程的本地路径（上传、删除的文件及创建、删除的目录）
+func (d *Directory) Upload(client sftp.Sftp, mapper PathMapper, modify []string) ([]string, error) {
+	changed := make([]string, 0, defaultSliceLength)
+	count := new(uploadCount)
+	defer func(){
+		uploadedFiles.Add(float64(count.files), d.name)
+		uploadedBytes.Add(float64(count.bytes), d.name)
+		removedTotal.Add(float64(count.removed), d.name)
+	}()
+	d.rename(client, mapper, modify, &changed) //重命名失败时按删除、新增处理
+	//检测结果中子目录在上级目录之前，远程Mkdir不会创建不存在的上级目录，按路径排序使上级目录先上传
+	sorted := append([]string(nil), modify...)
+	sort.Strings(sorted)
+	for _, path := range sorted {
+		dir, ok := d.DirMap[path]
+		if !ok || dir.Status == NotModify { //已随上级目录上传或删除
 			continue
 		}
-		err := upload(client,localBaseDir,remoteBaseDir,localSep,remoteSep,dir)
+		err := upload(client,mapper,dir,&changed,count,d.settled)
 		clear(dir, d.DirMap) //不管upload是否失败，都要clear一次
 		if err != nil {
-			return err
+			return changed, err
 		}
 	}
-	return nil
+	return changed, nil
+}
+
+//目录扫描，workers大于1时子目录由多个goroutine并发扫描
+//子目录的扫描结果按目录项顺序合并，与顺序扫描的结果及返回的错误一致
+type scanner struct {
+	dirIndex map[string]*DirectoryStruct
+	lock sync.Mutex                   //保护dirIndex
+	sem chan struct{}                 //空闲worker，为nil时顺序扫描
+	changes changeCount               //检测到的变更数，并发扫描时原子更新
+	scan uint64                       //当前轮次，记录到变化的文件中
+}
+
+func newScanner(dirIndex map[string]*DirectoryStruct, workers int, scan uint64) *scanner {
+	s := &scanner{dirIndex:dirIndex, scan:scan}
+	if workers > 1 {
+		s.sem = make(chan struct{}, workers-1) //当前goroutine也参与扫描
+	}
+	return s
+}
+
+func (s *scanner) index(path string) (*DirectoryStruct, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	dir, ok := s.dirIndex[path]
+	return dir, ok
+}
+
+func (s *scanner) setIndex(path string, dir *DirectoryStruct) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dirIndex[path] = dir
+}
+
+//有空闲worker时在新goroutine中执行，否则在当前goroutine中执行，避免递归扫描时互相等待
+func (s *scanner) spawn(group *sync.WaitGroup, task func()) {
+	group.Add(1)
+	select {
+	case s.sem <- struct{}{}:
+		go func(){
+			defer func(){
+				<-s.sem
+				group.Done()
+			}()
+			task()
+		}()
+	default:
+		task()
+		group.Done()
+	}
 }
 
-func traversalDir(srcDir string, dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct) error{
+//子目录扫描任务
+type scanTask struct {
+	path string
+	dir *DirectoryStruct
+	add bool                          //新增目录
+	modify []string
+	err error
+}
+
+func (s *scanner) traversalDir(srcDir string, dir *DirectoryStruct) error{
 	if !filepath.IsAbs(srcDir) {
 		return fmt.Errorf("%s is not absolute path", srcDir)
 	}
@@ -110,6 +275,7 @@ func traversalDir(srcDir string, dir *DirectoryStruct, dirIndex map[string]*Dire
 	}
 	dir.DirName = srcDir
 	dir.Status = Add
+	dir.ChangeTime = time.Now()
 	if dir.DirChild == nil {
 		dir.DirChild = make([]*DirectoryStruct, 0, defaultSliceLength)
 	}
@@ -120,29 +286,49 @@ func traversalDir(srcDir string, dir *DirectoryStruct, dirIndex map[string]*Dire
 		dir.ExistFile = make(map[string]bool)
 	}
 	dir.ExistFlag = true
+	tasks := make([]*scanTask, 0, defaultSliceLength)
+	group := sync.WaitGroup{}
+	var failed int32
 	for _, ele := range dirsContent {
 		if strings.Index(ele.Name(),prefixSkipFile) == 0 {
 			continue
 		}
 		absolutePath := fmt.Sprintf("%s%s%s",srcDir,string(filepath.Separator),ele.Name())
 		if ele.IsDir(){
-			childDir := new(DirectoryStruct)
-			childDir.ModifyTime = ele.ModTime()
-			if err := traversalDir(absolutePath, childDir, dirIndex); err != nil {
-				return fmt.Errorf("traversal directory failed, errMsg:%v", err)
+			if atomic.LoadInt32(&failed) != 0 { //已有子目录失败，不再扫描后续目录
+				break
 			}
-			dir.DirChild = append(dir.DirChild, childDir)        //存储子目录
+			task := &scanTask{path:absolutePath, dir:new(DirectoryStruct)}
+			task.dir.ModifyTime = ele.ModTime()
+			task.dir.Inode = inode(ele)
+			tasks = append(tasks, task)
+			s.spawn(&group, func(){
+				if task.err = s.traversalDir(task.path, task.dir); task.err != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			})
 		}else{
 			file := &FileStruct{
 				Name:absolutePath,
 				ModifyTime:ele.ModTime(),
+				Size:ele.Size(),
+				Inode:inode(ele),
 				Status:Add,
+				sized:true,
+				changeScan:s.scan,
 			}
-			dir.File = append(dir.File, file)                    //存储目录下非目录文件
+			dir.addFile(file)                                    //存储目录下非目录文件
 		}
 		dir.ExistFile[absolutePath] = dir.ExistFlag              //标记当前目录下所有文件
 	}
-	dirIndex[srcDir] = dir                                       //添加index，记录当前目录名对应的目录结构
+	group.Wait()
+	for _, task := range tasks {
+		if task.err != nil {
+			return fmt.Errorf("traversal directory failed, errMsg:%v", task.err)
+		}
+		dir.DirChild = append(dir.DirChild, task.dir)            //存储子目录
+	}
+	s.setIndex(srcDir, dir)                                      //添加index，记录当前目录名对应的目录结构
 	return nil
 }
 
@@ -161,7 +347,7 @@ func fillDirIndex(dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct) {
 	dirIndex[dir.DirName] = dir
 }
 
-func  checkDirModify(dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct) ([]string, error){
+func (s *scanner) checkDirModify(dir *DirectoryStruct) ([]string, error){
 	if !filepath.IsAbs(dir.DirName) {
 		return nil, fmt.Errorf("%s is not absolute path", dir.DirName)
 	}
@@ -175,6 +361,7 @@ func  checkDirModify(dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct)
 		return nil, fmt.Errorf("directory traversal:%s failed, errMs:%v", dir.DirName, err)
 	}
 	modifyDir := make([]string, 0, defaultSliceLength)
+	now := time.Now()
 	dir.ExistFlag = !dir.ExistFlag  //表示新的一轮check
 	var e error = nil
 	defer func(){
@@ -185,6 +372,9 @@ func  checkDirModify(dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct)
 			}
 		}
 	}()
+	tasks := make([]*scanTask, 0, defaultSliceLength)
+	group := sync.WaitGroup{}
+	var failed int32
 	for _, ele := range dirsContent {
 		if strings.Index(ele.Name(),prefixSkipFile) == 0 {
 			continue
@@ -192,78 +382,113 @@ func  checkDirModify(dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct)
 		absolutePath := fmt.Sprintf("%s%s%s",dir.DirName,string(filepath.Separator),ele.Name())
 		dir.ExistFile[absolutePath] = dir.ExistFlag
 		if ele.IsDir(){
-			if _, ok := dirIndex[absolutePath]; !ok {  //不存在目录索引中，即新增目录，加载新的目录内容
-				childDir := new(DirectoryStruct)
-				childDir.ModifyTime = ele.ModTime()
-				if err := traversalDir(absolutePath, childDir, dirIndex); err != nil {
-					e = err
-					return nil, fmt.Errorf("traversal directory[%s] failed, errMsg:%v", absolutePath, err)
-				}
-				dir.DirChild = append(dir.DirChild, childDir)
-				if dir.Status == NotModify {
-					dir.Status = Modify
-				}
+			if atomic.LoadInt32(&failed) != 0 { //已有子目录失败，不再扫描后续目录
+				break
+			}
+			task := &scanTask{path:absolutePath}
+			if child, ok := s.index(absolutePath); !ok {  //不存在目录索引中，即新增目录，加载新的目录内容
+				task.add = true
+				task.dir = new(DirectoryStruct)
+				task.dir.ModifyTime = ele.ModTime()
+				task.dir.Inode = inode(ele)
 			}else{
-				dirIndex[absolutePath].ModifyTime = ele.ModTime()
-				modify, err := checkDirModify(dirIndex[absolutePath], dirIndex)
-				if err != nil {
-					e = err
-					return nil, fmt.Errorf("checkDirModify directory[%s] failed, errMsg:%v", absolutePath, err)
-				}
-				modifyDir = append(modifyDir, modify...)
+				task.dir = child
+				child.ModifyTime = ele.ModTime()
+				child.Inode = inode(ele)
 			}
+			tasks = append(tasks, task)
+			s.spawn(&group, func(){
+				if task.add {
+					task.err = s.traversalDir(task.path, task.dir)
+				}else{
+					task.modify, task.err = s.checkDirModify(task.dir)
+				}
+				if task.err != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			})
 		}else{
-			continueFlag := false
-			for _, file := range dir.File {
-				if absolutePath == file.Name { //检查已存在的文件是否发生变化
-					if file.ModifyTime.Before(ele.ModTime()) {
-						file.ModifyTime = ele.ModTime()
+			if file := dir.lookupFile(ele.Name()); file != nil { //检查已存在的文件是否发生变化
+				//修改时间变化或大小变化（文件仍在写入）都视为修改，旧记录中没有大小时只比较修改时间
+				if file.ModifyTime.Before(ele.ModTime()) || ((file.sized || file.Size != 0) && file.Size != ele.Size()) {
+					file.ModifyTime = ele.ModTime()
+					file.changeScan = s.scan
+					if file.Status != Add {
 						file.Status = Modify
-						if dir.Status == NotModify {
-							dir.Status = Modify
-						}
 					}
-					continueFlag = true
-					break
+					atomic.AddInt64(&s.changes.modify, 1)
+					dir.ChangeTime = now
+					if dir.Status == NotModify {
+						dir.Status = Modify
+					}
 				}
-			}
-			if continueFlag {
+				file.Size = ele.Size()
+				file.sized = true
+				file.Inode = inode(ele)
 				continue
 			}
 			//新增文件
 			file := &FileStruct{
 				Name:absolutePath,
 				ModifyTime:ele.ModTime(),
+				Size:ele.Size(),
+				Inode:inode(ele),
 				Status:Add,
+				sized:true,
+				changeScan:s.scan,
 			}
-			dir.File = append(dir.File, file)
+			dir.addFile(file)
+			atomic.AddInt64(&s.changes.add, 1)
+			dir.ChangeTime = now
 			if dir.Status == NotModify {
 				dir.Status = Modify
 			}
 		}
 	}
+	group.Wait()
+	for _, task := range tasks {
+		if task.err != nil {
+			e = task.err
+			if task.add {
+				return nil, fmt.Errorf("traversal directory[%s] failed, errMsg:%v", task.path, task.err)
+			}
+			return nil, fmt.Errorf("checkDirModify directory[%s] failed, errMsg:%v", task.path, task.err)
+		}
+		if task.add {
+			dir.DirChild = append(dir.DirChild, task.dir)
+			atomic.AddInt64(&s.changes.add, 1)
+			dir.ChangeTime = now
+			if dir.Status == NotModify {
+				dir.Status = Modify
+			}
+		}else{
+			modifyDir = append(modifyDir, task.modify...)
+		}
+	}
 	deleteKey := make([]string, 0, defaultSliceLength)
 	for file, value := range dir.ExistFile {
 		if value == dir.ExistFlag { //与当前ExistFlag不一致时，表示此时遍历未遍历到该文件，即不一致对应的文件已删除
 			continue
 		}
 		deleteKey = append(deleteKey, file) //记录当前遍历已经不存在的文件
-		if _, ok := dirIndex[file]; ok {
+		if child, ok := s.index(file); ok {
 			//删除的目录
 			//注意：上述处理中只会递归检测仍然存在的目录，对于已删除的目录不会检测，因此不会出现递归目录中存在多个删除目录事件
 			//即被删除目录可以直接删除，不用检测其上级目录是否存在
-			dirIndex[file].Status = Delete
+			child.stale = child.Status != NotModify
+			child.Status = Delete
+			atomic.AddInt64(&s.changes.delete, 1)
+			dir.ChangeTime = now
 			if dir.Status == NotModify {
 				dir.Status = Modify
 			}
-		}else{
-			for _, f := range dir.File {
-				if f.Name == file{
-					f.Status = Delete
-					if dir.Status == NotModify {
-						dir.Status = Modify
-					}
-				}
+		}else if f := dir.lookupFile(filepath.Base(file)); f != nil {
+			f.stale = f.Status != NotModify
+			f.Status = Delete
+			atomic.AddInt64(&s.changes.delete, 1)
+			dir.ChangeTime = now
+			if dir.Status == NotModify {
+				dir.Status = Modify
 			}
 		}
 	}
@@ -281,24 +506,33 @@ func  checkDirModify(dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct)
 //增量上传时，要处理Modify目录下的所有更变文件，即Add，Modify，Delete
 //删除的目录会变更上一级目录的状态，即改为Modify，继而交到Modify处理子目录中
 
-func upload(client sftp.Sftp, localBaseDir,remoteBaseDir,localSep, remoteSep string, dir *DirectoryStruct) error {
-	localBaseDirLen := len(localBaseDir)
-	remotePath := fmt.Sprintf("%s%s%s%s", remoteBaseDir, remoteSep, filepath.Base(localBaseDir), strings.Join(strings.Split(dir.DirName[localBaseDirLen:], localSep), remoteSep))
+//settled返回false的文件本次不上传，保持变更状态，目录改为Modify等待下一轮检测
+func upload(client sftp.Sftp, mapper PathMapper, dir *DirectoryStruct, changed *[]string, count *uploadCount, settled func(*FileStruct) bool) error {
+	remotePath := mapper.Remote(dir.DirName)
+	pending := false
 	switch dir.Status {
 	case Add:
 		if err := client.Mkdir(remotePath); err != nil {
 			return err
 		}
+		*changed = append(*changed, dir.DirName)
 		for _, nextDir := range dir.DirChild {
-			err := upload(client, localBaseDir, remoteBaseDir, localSep, remoteSep, nextDir)
+			err := upload(client, mapper, nextDir, changed, count, settled)
 			if err != nil {
 				return err
 			}
 		}
 		for _, file := range dir.File {
-			if err := client.Put(file.Name, strings.Join([]string{remotePath, filepath.Base(file.Name)}, remoteSep)); err != nil {
+			if !settled(file) {
+				pending = true
+				continue
+			}
+			if err := client.Put(file.Name, mapper.Remote(file.Name)); err != nil {
 				return err
 			}
+			*changed = append(*changed, file.Name)
+			count.files++
+			count.bytes += sentBytes(client, file)
 			file.Status = NotModify
 		}
 		dir.Status = NotModify
@@ -306,14 +540,16 @@ func upload(client sftp.Sftp, localBaseDir,remoteBaseDir,localSep, remoteSep str
 		for _, nextDir := range dir.DirChild {
 			switch nextDir.Status {
 			case Add:
-				err := upload(client, localBaseDir, remoteBaseDir, localSep, remoteSep, nextDir)
+				err := upload(client, mapper, nextDir, changed, count, settled)
 				if err != nil {
 					return err
 				}
 			case Delete:
-				if err := client.RemoveDirectory(strings.Join([]string{remotePath, filepath.Base(nextDir.DirName)}, remoteSep)); err != nil {
+				if err := client.RemoveDirectory(mapper.Remote(nextDir.DirName)); err != nil {
 					return err
 				}
+				*changed = append(*changed, nextDir.DirName)
+				count.removed++
 				nextDir.Status = ShiftDelete
 			}
 		}
@@ -322,19 +558,31 @@ func upload(client sftp.Sftp, localBaseDir,remoteBaseDir,localSep, remoteSep str
 			case Add:
 				fallthrough
 			case Modify:
-				if err := client.Put(file.Name, strings.Join([]string{remotePath, filepath.Base(file.Name)}, remoteSep)); err != nil {
+				if !settled(file) {
+					pending = true
+					continue
+				}
+				if err := client.Put(file.Name, mapper.Remote(file.Name)); err != nil {
 					return err
 				}
+				*changed = append(*changed, file.Name)
+				count.files++
+				count.bytes += sentBytes(client, file)
 				file.Status = NotModify
 			case Delete:
-				if err := client.Remove(strings.Join([]string{remotePath, filepath.Base(file.Name)}, remoteSep)); err != nil {
+				if err := client.Remove(mapper.Remote(file.Name)); err != nil {
 					return err
 				}
+				*changed = append(*changed, file.Name)
+				count.removed++
 				file.Status = ShiftDelete
 			}
 		}
 		dir.Status = NotModify
 	}
+	if pending { //目录已创建，剩余的文件按修改处理
+		dir.Status = Modify
+	}
 	return nil
 }
 
@@ -350,6 +598,9 @@ func clear(dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct) {
 		}
 		if dir.File[i].Status == ShiftDelete {
 			total -= 1
+			if dir.files != nil {
+				delete(dir.files, filepath.Base(dir.File[i].Name))
+			}
 			dir.File[i] = dir.File[total]
 			dir.File = dir.File[:total]
 		}else{
@@ -364,20 +615,20 @@ func clear(dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct) {
 		}
 		if dir.DirChild[i].Status == ShiftDelete {
 			total -= 1
-			//清理目录索引
-			deleteIndexKey := make([]string, 0, defaultSliceLength)
-			for key, _ := range dirIndex {
-				if strings.Index(key, dir.DirChild[i].DirName) == 0 {
-					deleteIndexKey = append(deleteIndexKey, key)
-				}
-			}
-			for _, key := range deleteIndexKey {
-				delete(dirIndex, key)
-			}
+			removeIndex(dir.DirChild[i], dirIndex) //清理目录索引
 			dir.DirChild[i] = dir.DirChild[total]
 			dir.DirChild = dir.DirChild[:total]
 		}else{
 			i++
 		}
 	}
+}
+
+//删除目录及其所有子目录的索引，只遍历被删除的子树
+//不能按路径前缀匹配整个索引，否则删除/a/b时会误删/a/bc
+func removeIndex(dir *DirectoryStruct, dirIndex map[string]*DirectoryStruct) {
+	for _, child := range dir.DirChild {
+		removeIndex(child, dirIndex)
+	}
+	delete(dirIndex, dir.DirName)
 }
\ No newline at end of file
@@ -2,8 +2,14 @@ package dir
 
 import (
 	"bytes"
+	"conf"
 	"fmt"
+	"io/ioutil"
+	"mapping"
+	"os"
+	"path/filepath"
 	"sftp"
+	"strings"
 	"testing"
 	"time"
 )
@@ -70,8 +76,11 @@ func TestDirectory_Modify(t *testing.T) {
 	}
 	defer client.Close()
 
-	if err := dir.Upload(client, "E:\\test_data",
-		"/home/valvrave/sftp-test", "\\", "/", []string{"E:\\test_data"}); err != nil {
+	mapper, err := mapping.New(&conf.ProjectConfig{LocalBaseDir:"E:\\test_data", RemoteBaseDir:"/home/valvrave/sftp-test"}, "\\", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dir.Upload(client, mapper, []string{"E:\\test_data"}); err != nil {
 		t.Errorf("upload failed, err:%v", err)
 	}
 
@@ -99,9 +108,8 @@ func TestDirectory_Modify(t *testing.T) {
 
 	fmt.Println("modify:", modify)
 
-	fmt.Println("map:", dir.(*directory).dirIndex)
-	if err := dir.Upload(client, "E:\\test_data",
-		"/home/valvrave/sftp-test", "\\", "/", modify); err != nil {
+	fmt.Println("map:", dir.DirMap)
+	if _, err := dir.Upload(client, mapper, modify); err != nil {
 		t.Errorf("upload failed, err:%v", err)
 	}
 	buf.Truncate(0)
@@ -110,5 +118,449 @@ func TestDirectory_Modify(t *testing.T) {
 		t.Error("write failed, err:",err)
 	}
 	fmt.Println("same:", buf.String())
-	fmt.Println("map:", dir.(*directory).dirIndex)
+	fmt.Println("map:", dir.DirMap)
+}
+
+func TestDirectory_CheckModifySize(t *testing.T) {
+	base := t.TempDir()
+	name := filepath.Join(base, "writing.log")
+	if err := ioutil.WriteFile(name, []byte("part"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour)
+	os.Chtimes(name, mtime, mtime)
+	dir := New()
+	if err := dir.Open(base); err != nil {
+		t.Fatal(err)
+	}
+	dir.Dir.Status = NotModify
+	dir.Dir.File[0].Status = NotModify
+	dir.Dir.ChangeTime = time.Time{}
+
+	//修改时间不变，只有大小变化时同样视为修改
+	if err := ioutil.WriteFile(name, []byte("part-2"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(name, mtime, mtime)
+	modify, err := dir.CheckModify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modify) != 1 || dir.Dir.File[0].Status != Modify {
+		t.Errorf("size change not detected, modify:%v", modify)
+	}
+	if since := time.Since(dir.LastChange(modify)); since > time.Second {
+		t.Errorf("last change %v ago", since)
+	}
+}
+
+func TestDirectory_WriteCheck(t *testing.T) {
+	base := t.TempDir()
+	name := filepath.Join(base, "writing.log")
+	if err := ioutil.WriteFile(name, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour)
+	os.Chtimes(name, mtime, mtime)
+	dir := New()
+	dir.SetWriteCheck(true)
+	if err := dir.Open(base); err != nil {
+		t.Fatal(err)
+	}
+	markSynced(dir.Dir)
+	mapper, _ := mapping.New(&conf.ProjectConfig{LocalBaseDir: base, RemoteBaseDir: "/remote", StripBaseDir: true}, string(filepath.Separator), "/")
+
+	//空文件写入内容，修改时间不变时同样检测为修改，本轮检测到变化不上传
+	if err := ioutil.WriteFile(name, []byte("part"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(name, mtime, mtime)
+	modify, err := dir.CheckModify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modify) != 1 || dir.Dir.File[0].Status != Modify {
+		t.Fatalf("0 to 4 bytes not detected, modify:%v", modify)
+	}
+	client := new(recordClient)
+	if _, err := dir.Upload(client, mapper, modify); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.ops) != 0 || dir.Dir.Status != Modify {
+		t.Fatalf("file still changing was uploaded, ops:%v", client.ops)
+	}
+
+	//下一轮检测没有变化后上传
+	if modify, err = dir.CheckModify(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dir.Upload(client, mapper, modify); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.ops) != 1 || client.ops[0] != "put /remote/writing.log" {
+		t.Errorf("ops:%v", client.ops)
+	}
+	if modify, _ := dir.CheckModify(); len(modify) != 0 {
+		t.Errorf("still modify after upload:%v", modify)
+	}
+}
+
+//新建的嵌套目录经过两轮检测后上传，上级目录先创建
+func TestDirectory_WriteCheckNested(t *testing.T) {
+	base := t.TempDir()
+	dir := New()
+	dir.SetWriteCheck(true)
+	if err := dir.Open(base); err != nil {
+		t.Fatal(err)
+	}
+	markSynced(dir.Dir)
+	mapper, _ := mapping.New(&conf.ProjectConfig{LocalBaseDir: base, RemoteBaseDir: "/remote", StripBaseDir: true}, string(filepath.Separator), "/")
+
+	os.MkdirAll(filepath.Join(base, "a", "b"), 0777)
+	ioutil.WriteFile(filepath.Join(base, "a", "b", "x.txt"), []byte("x"), 0666)
+	dir.CheckModify() //新目录加入，文件本轮有变化
+	modify, err := dir.CheckModify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := new(recordClient)
+	if _, err := dir.Upload(client, mapper, modify); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"mkdir /remote/a", "mkdir /remote/a/b", "put /remote/a/b/x.txt"}
+	if strings.Join(client.ops, ",") != strings.Join(expect, ",") {
+		t.Errorf("ops:%v, expect %v", client.ops, expect)
+	}
+}
+
+//记录操作的sftp客户端
+type recordClient struct {
+	ops []string
+}
+
+func (c *recordClient) Close() {}
+func (c *recordClient) Put(local, remote string) error {
+	c.ops = append(c.ops, "put "+remote)
+	return nil
+}
+func (c *recordClient) Mkdir(remote string) error {
+	c.ops = append(c.ops, "mkdir "+remote)
+	return nil
+}
+func (c *recordClient) Remove(remote string) error {
+	c.ops = append(c.ops, "remove "+remote)
+	return nil
+}
+func (c *recordClient) RemoveDirectory(remote string) error {
+	c.ops = append(c.ops, "rmdir "+remote)
+	return nil
+}
+func (c *recordClient) Run(cmd string, timeout time.Duration) (string, string, error) {
+	return "", "", nil
+}
+func (c *recordClient) Rename(oldRemote, newRemote string) error {
+	c.ops = append(c.ops, "rename "+oldRemote+" "+newRemote)
+	return nil
+}
+func (c *recordClient) ReadDir(remote string) ([]os.FileInfo, error) {
+	return nil, nil
+}
+func (c *recordClient) Stat(remote string) (os.FileInfo, error) {
+	return nil, os.ErrNotExist
+}
+
+func TestDirectory_Rename(t *testing.T) {
+	base := t.TempDir()
+	os.MkdirAll(filepath.Join(base, "a"), 0777)
+	os.MkdirAll(filepath.Join(base, "old", "child"), 0777)
+	ioutil.WriteFile(filepath.Join(base, "a", "x.txt"), []byte("x"), 0666)
+	ioutil.WriteFile(filepath.Join(base, "old", "child", "y.txt"), []byte("y"), 0666)
+	ioutil.WriteFile(filepath.Join(base, "z.txt"), []byte("z"), 0666)
+	dir := New()
+	if err := dir.Open(base); err != nil {
+		t.Fatal(err)
+	}
+	markSynced(dir.Dir)
+
+	os.Rename(filepath.Join(base, "a", "x.txt"), filepath.Join(base, "x.txt"))
+	os.Rename(filepath.Join(base, "old"), filepath.Join(base, "new"))
+	modify, err := dir.CheckModify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper, _ := mapping.New(&conf.ProjectConfig{LocalBaseDir: base, RemoteBaseDir: "/remote", StripBaseDir: true}, string(filepath.Separator), "/")
+	client := new(recordClient)
+	if _, err := dir.Upload(client, mapper, modify); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]bool{
+		"rename /remote/a/x.txt /remote/x.txt": true,
+		"rename /remote/old /remote/new":       true,
+	}
+	if len(client.ops) != len(expect) {
+		t.Fatalf("ops:%v", client.ops)
+	}
+	for _, op := range client.ops {
+		if !expect[op] {
+			t.Errorf("unexpected op:%s", op)
+		}
+	}
+	if _, ok := dir.DirMap[filepath.Join(base, "old", "child")]; ok {
+		t.Error("old directory index not cleared")
+	}
+	if modify, _ := dir.CheckModify(); len(modify) != 0 {
+		t.Errorf("still modify after rename:%v", modify)
+	}
+}
+
+//生成dirs个目录，每个目录files个文件
+func benchTree(b *testing.B, dirs, files int) string {
+	base := b.TempDir()
+	for i := 0; i < dirs; i++ {
+		sub := filepath.Join(base, fmt.Sprintf("dir%d", i))
+		if err := os.Mkdir(sub, 0777); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < files; j++ {
+			if err := ioutil.WriteFile(filepath.Join(sub, fmt.Sprintf("file%d", j)), nil, 0666); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return base
+}
+
+func BenchmarkDirectory_CheckModify(b *testing.B) {
+	for _, files := range []int{100, 1000, 5000} {
+		b.Run(fmt.Sprintf("files=%d", files), func(b *testing.B) {
+			base := benchTree(b, 4, files)
+			dir := New()
+			if err := dir.Open(base); err != nil {
+				b.Fatal(err)
+			}
+			markSynced(dir.Dir)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := dir.CheckModify(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDirectory_RemoveDirectory(b *testing.B) {
+	for _, dirs := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("dirs=%d", dirs), func(b *testing.B) {
+			client := new(recordClient)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dir := New()
+				dir.Dir = &DirectoryStruct{DirName: "/base", Status: Modify}
+				dir.Dir.DirChild = make([]*DirectoryStruct, 0, dirs)
+				for j := 0; j < dirs; j++ {
+					child := &DirectoryStruct{DirName: fmt.Sprintf("/base/dir%d", j)}
+					dir.Dir.DirChild = append(dir.Dir.DirChild, child)
+				}
+				fillDirIndex(dir.Dir, dir.DirMap)
+				//删除一半目录
+				for j := 0; j < dirs; j += 2 {
+					dir.Dir.DirChild[j].Status = Delete
+				}
+				mapper, _ := mapping.New(&conf.ProjectConfig{LocalBaseDir: "/base", RemoteBaseDir: "/remote"}, "/", "/")
+				b.StartTimer()
+				if _, err := dir.Upload(client, mapper, []string{"/base"}); err != nil {
+					b.Fatal(err)
+				}
+				client.ops = client.ops[:0]
+			}
+		})
+	}
+}
+
+func TestDirectory_ClearIndex(t *testing.T) {
+	dir := New()
+	dir.Dir = &DirectoryStruct{DirName: "/base", Status: Modify, DirChild: []*DirectoryStruct{
+		{DirName: "/base/a", Status: Delete, DirChild: []*DirectoryStruct{{DirName: "/base/a/sub"}}},
+		{DirName: "/base/ab"},
+	}}
+	fillDirIndex(dir.Dir, dir.DirMap)
+	mapper, _ := mapping.New(&conf.ProjectConfig{LocalBaseDir: "/base", RemoteBaseDir: "/remote"}, "/", "/")
+	if _, err := dir.Upload(new(recordClient), mapper, []string{"/base"}); err != nil {
+		t.Fatal(err)
+	}
+	for path, exist := range map[string]bool{"/base": true, "/base/a": false, "/base/a/sub": false, "/base/ab": true} {
+		if _, ok := dir.DirMap[path]; ok != exist {
+			t.Errorf("index %s exist:%v, expect %v", path, ok, exist)
+		}
+	}
+}
+
+func TestDirectory_ScanWorkers(t *testing.T) {
+	base := t.TempDir()
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			sub := filepath.Join(base, fmt.Sprintf("dir%d", i), fmt.Sprintf("sub%d", j))
+			os.MkdirAll(sub, 0777)
+			ioutil.WriteFile(filepath.Join(sub, "file"), []byte("a"), 0666)
+		}
+	}
+	open := func(workers int) *Directory {
+		dir := New()
+		dir.SetScanWorkers(workers)
+		if err := dir.Open(base); err != nil {
+			t.Fatal(err)
+		}
+		markSynced(dir.Dir)
+		return dir
+	}
+	serial, parallel := open(1), open(8)
+	if len(serial.DirMap) != 31 || len(parallel.DirMap) != 31 {
+		t.Fatalf("index size serial:%d parallel:%d", len(serial.DirMap), len(parallel.DirMap))
+	}
+
+	os.RemoveAll(filepath.Join(base, "dir1"))
+	os.MkdirAll(filepath.Join(base, "dir5", "sub0"), 0777)
+	for i := 0; i < 5; i++ {
+		ioutil.WriteFile(filepath.Join(base, "dir2", fmt.Sprintf("sub%d", i), "new"), nil, 0666)
+	}
+	serialModify, err := serial.CheckModify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallelModify, err := parallel.CheckModify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(serialModify) != fmt.Sprint(parallelModify) {
+		t.Errorf("serial:%v parallel:%v", serialModify, parallelModify)
+	}
+	serialJson, parallelJson := new(bytes.Buffer), new(bytes.Buffer)
+	serial.EncodeJson(serialJson)
+	parallel.EncodeJson(parallelJson)
+	if serialJson.String() != parallelJson.String() {
+		t.Error("serial and parallel scan result mismatch")
+	}
+
+	//子目录不可读时返回错误
+	if os.Getuid() != 0 {
+		os.Chmod(filepath.Join(base, "dir3"), 0)
+		defer os.Chmod(filepath.Join(base, "dir3"), 0777)
+		if _, err := parallel.CheckModify(); err == nil {
+			t.Error("expect permission error")
+		}
+	}
+}
+
+func TestDirectory_EncodeDecode(t *testing.T) {
+	base := t.TempDir()
+	os.MkdirAll(filepath.Join(base, "sub"), 0777)
+	ioutil.WriteFile(filepath.Join(base, "sub", "a.txt"), []byte("a"), 0666)
+	dir := New()
+	if err := dir.Open(base); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(t.TempDir(), "moved")
+	for _, format := range []string{FormatJson, FormatBinary} {
+		buf := new(bytes.Buffer)
+		if err := dir.Encode(buf, "test", format); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Count(buf.Bytes(), []byte(base)) > 1 {
+			t.Errorf("%s state repeats absolute path", format)
+		}
+		decode := New()
+		version, err := decode.Decode(bytes.NewReader(buf.Bytes()), "test", moved)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(moved, "sub", "a.txt")
+		sub, ok := decode.DirMap[filepath.Join(moved, "sub")]
+		if version != StateVersion || !ok || sub.File[0].Name != file || sub.File[0].Size != 1 || sub.Status != Add {
+			t.Errorf("%s decode mismatch, version:%d index:%v", format, version, decode.DirMap)
+		}
+		if !sub.File[0].ModifyTime.Equal(dir.DirMap[filepath.Join(base, "sub")].File[0].ModifyTime) {
+			t.Errorf("%s modify time mismatch", format)
+		}
+		if _, err := New().Decode(bytes.NewReader(buf.Bytes()), "other", moved); err == nil {
+			t.Errorf("%s expect project mismatch error", format)
+		}
+	}
+
+	//EncodeJson输出的旧格式自动迁移
+	legacy := new(bytes.Buffer)
+	if err := dir.EncodeJson(legacy); err != nil {
+		t.Fatal(err)
+	}
+	decode := New()
+	version, err := decode.Decode(legacy, "test", moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decode.DirMap[filepath.Join(moved, "sub")]; version != 1 || !ok {
+		t.Errorf("legacy decode mismatch, version:%d index:%v", version, decode.DirMap)
+	}
+}
+
+func TestDirectory_Metrics(t *testing.T) {
+	base := t.TempDir()
+	ioutil.WriteFile(filepath.Join(base, "a.txt"), []byte("a"), 0666)
+	ioutil.WriteFile(filepath.Join(base, "b.txt"), []byte("b"), 0666)
+	dir := New()
+	dir.SetName("metrics-test")
+	defer dir.DeleteMetrics()
+	if err := dir.Open(base); err != nil {
+		t.Fatal(err)
+	}
+	markSynced(dir.Dir)
+
+	os.Remove(filepath.Join(base, "b.txt"))
+	ioutil.WriteFile(filepath.Join(base, "c.txt"), []byte("ccc"), 0666)
+	os.MkdirAll(filepath.Join(base, "sub"), 0777)
+	modify, err := dir.CheckModify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := scansTotal.Value("metrics-test"); n != 1 {
+		t.Errorf("scans %v, expect 1", n)
+	}
+	if n := changesDetected.Value("metrics-test", "add"); n != 2 {
+		t.Errorf("add changes %v, expect 2", n)
+	}
+	if n := changesDetected.Value("metrics-test", "delete"); n != 1 {
+		t.Errorf("delete changes %v, expect 1", n)
+	}
+	mapper, _ := mapping.New(&conf.ProjectConfig{LocalBaseDir: base, RemoteBaseDir: "/remote"}, string(filepath.Separator), "/")
+	if _, err := dir.Upload(new(recordClient), mapper, modify); err != nil {
+		t.Fatal(err)
+	}
+	if n := uploadedFiles.Value("metrics-test"); n != 1 {
+		t.Errorf("uploaded files %v, expect 1", n)
+	}
+	if n := uploadedBytes.Value("metrics-test"); n != 3 {
+		t.Errorf("uploaded bytes %v, expect 3", n)
+	}
+	if n := removedTotal.Value("metrics-test"); n != 1 {
+		t.Errorf("removed %v, expect 1", n)
+	}
+
+	//客户端返回实际发送的字节数时（转换后上传）以其为准
+	ioutil.WriteFile(filepath.Join(base, "c.txt"), []byte("cccc"), 0666)
+	modify, _ = dir.CheckModify()
+	if _, err := dir.Upload(&sentClient{sent: 2}, mapper, modify); err != nil {
+		t.Fatal(err)
+	}
+	if n := uploadedBytes.Value("metrics-test"); n != 5 {
+		t.Errorf("uploaded bytes %v, expect 5", n)
+	}
+}
+
+type sentClient struct {
+	recordClient
+	sent int64
+}
+
+func (c *sentClient) LastSent() int64 {
+	return c.sent
 }
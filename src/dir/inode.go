@@ -0,0 +1,16 @@
+//go:build !windows
+
+package dir
+
+import (
+	"os"
+	"syscall"
+)
+
+//返回文件的inode编号，无法获取时返回0
+func inode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,8 @@
+package dir
+
+import "os"
+
+//windows下FileInfo不包含文件编号，重命名检测只比较大小和修改时间
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,71 @@
+package dir
+
+import (
+	"metrics"
+	"sftp"
+)
+
+var (
+	scansTotal = metrics.NewCounterVec("autosftp_scans_total", "Number of change detection scans.", "project")
+	scanFailures = metrics.NewCounterVec("autosftp_scan_failures_total", "Number of failed change detection scans.", "project")
+	scanDuration = metrics.NewHistogramVec("autosftp_scan_duration_seconds", "Duration of change detection scans.", nil, "project")
+	changesDetected = metrics.NewCounterVec("autosftp_changes_detected_total", "Detected changes of files and directories by type (add, modify, delete).", "project", "type")
+	uploadedFiles = metrics.NewCounterVec("autosftp_uploaded_files_total", "Number of files uploaded.", "project")
+	uploadedBytes = metrics.NewCounterVec("autosftp_uploaded_bytes_total", "Bytes of files uploaded.", "project")
+	removedTotal = metrics.NewCounterVec("autosftp_removed_total", "Number of remote files and directories removed.", "project")
+)
+
+//一次扫描检测到的变更数
+type changeCount struct {
+	add int64
+	modify int64
+	delete int64
+}
+
+//一次上传的文件数和字节数
+type uploadCount struct {
+	files int64
+	bytes int64
+	removed int64
+}
+
+//可以返回最近一次上传实际发送字节数的客户端，小于0表示未知
+type SentReporter interface {
+	LastSent() int64
+}
+
+//上传的字节数：转换后上传时与扫描到的文件大小不同，客户端能返回实际发送的字节数时以其为准
+func sentBytes(client sftp.Sftp, file *FileStruct) int64 {
+	if r, ok := client.(SentReporter); ok {
+		if n := r.LastSent(); n >= 0 {
+			return n
+		}
+	}
+	return file.Size
+}
+
+//设置指标中的项目名称，计数器初始化为0以便告警规则能区分没有数据和没有发生
+func (d *Directory) SetName(name string) {
+	d.name = name
+	scansTotal.Add(0, name)
+	scanFailures.Add(0, name)
+	for _, typ := range []string{"add", "modify", "delete"} {
+		changesDetected.Add(0, name, typ)
+	}
+	uploadedFiles.Add(0, name)
+	uploadedBytes.Add(0, name)
+	removedTotal.Add(0, name)
+}
+
+//删除项目的指标，项目关闭后调用
+func (d *Directory) DeleteMetrics() {
+	scansTotal.Delete(d.name)
+	scanFailures.Delete(d.name)
+	scanDuration.Delete(d.name)
+	for _, typ := range []string{"add", "modify", "delete"} {
+		changesDetected.Delete(d.name, typ)
+	}
+	uploadedFiles.Delete(d.name)
+	uploadedBytes.Delete(d.name)
+	removedTotal.Delete(d.name)
+}
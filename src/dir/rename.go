@@ -0,0 +1,156 @@
+package dir
+
+import (
+	"path/filepath"
+	"sftp"
+)
+
+//检测同一轮变更中被删除和新增的文件、目录是否为重命名（移动），是则直接在远程重命名，避免重新上传
+//只处理状态为Modify的目录（远程已存在）下的变更，匹配规则：
+//  文件：大小、修改时间一致，双方都有inode时inode也必须一致
+//  目录：整棵子树的文件名、大小、修改时间一致，双方都有inode时inode也必须一致
+//只有一一对应的匹配才视为重命名，匹配不确定或远程重命名失败时保持原状态，按删除、新增处理
+func (d *Directory) rename(client sftp.Sftp, mapper PathMapper, modify []string, changed *[]string) {
+	var addFiles, delFiles []*FileStruct
+	var addDirs, delDirs []*DirectoryStruct
+	for _, path := range modify {
+		dir, ok := d.DirMap[path]
+		if !ok || dir.Status != Modify {
+			continue
+		}
+		for _, file := range dir.File {
+			switch file.Status {
+			case Add:
+				addFiles = append(addFiles, file)
+			case Delete:
+				if !file.stale {
+					delFiles = append(delFiles, file)
+				}
+			}
+		}
+		for _, child := range dir.DirChild {
+			switch child.Status {
+			case Add:
+				addDirs = append(addDirs, child)
+			case Delete:
+				if !child.stale && synced(child) {
+					delDirs = append(delDirs, child)
+				}
+			}
+		}
+	}
+	if len(addFiles) != 0 && len(delFiles) != 0 {
+		pairs := matchPairs(len(addFiles), len(delFiles), func(i, j int) bool {
+			return sameFile(addFiles[i], delFiles[j])
+		})
+		for i, j := range pairs {
+			if err := client.Rename(mapper.Remote(delFiles[j].Name), mapper.Remote(addFiles[i].Name)); err != nil {
+				continue
+			}
+			*changed = append(*changed, delFiles[j].Name, addFiles[i].Name)
+			delFiles[j].Status = ShiftDelete
+			addFiles[i].Status = NotModify
+		}
+	}
+	if len(addDirs) != 0 && len(delDirs) != 0 {
+		pairs := matchPairs(len(addDirs), len(delDirs), func(i, j int) bool {
+			return sameInode(addDirs[i].Inode, delDirs[j].Inode) && sameTree(addDirs[i], delDirs[j])
+		})
+		for i, j := range pairs {
+			if err := client.Rename(mapper.Remote(delDirs[j].DirName), mapper.Remote(addDirs[i].DirName)); err != nil {
+				continue
+			}
+			*changed = append(*changed, delDirs[j].DirName, addDirs[i].DirName)
+			delDirs[j].Status = ShiftDelete
+			markSynced(addDirs[i])
+		}
+	}
+}
+
+//返回新增下标到删除下标的一一对应关系，存在多个候选的一方都不参与匹配
+func matchPairs(addLen, delLen int, match func(i, j int) bool) map[int]int {
+	addCandidate := make([]int, addLen)
+	delCount := make([]int, delLen)
+	for i := 0; i < addLen; i++ {
+		addCandidate[i] = -1
+		for j := 0; j < delLen; j++ {
+			if !match(i, j) {
+				continue
+			}
+			delCount[j]++
+			if addCandidate[i] == -1 {
+				addCandidate[i] = j
+			} else {
+				addCandidate[i] = -2 //多个候选
+			}
+		}
+	}
+	pairs := make(map[int]int)
+	for i, j := range addCandidate {
+		if j >= 0 && delCount[j] == 1 {
+			pairs[i] = j
+		}
+	}
+	return pairs
+}
+
+func sameInode(a, b uint64) bool {
+	return a == 0 || b == 0 || a == b
+}
+
+func sameFile(a, b *FileStruct) bool {
+	return a.Size == b.Size && a.ModifyTime.Equal(b.ModifyTime) && sameInode(a.Inode, b.Inode)
+}
+
+//比较两棵目录树的文件名、大小和修改时间
+func sameTree(a, b *DirectoryStruct) bool {
+	if len(a.File) != len(b.File) || len(a.DirChild) != len(b.DirChild) {
+		return false
+	}
+	files := make(map[string]*FileStruct, len(b.File))
+	for _, file := range b.File {
+		files[filepath.Base(file.Name)] = file
+	}
+	for _, file := range a.File {
+		other, ok := files[filepath.Base(file.Name)]
+		if !ok || !sameFile(file, other) {
+			return false
+		}
+	}
+	dirs := make(map[string]*DirectoryStruct, len(b.DirChild))
+	for _, child := range b.DirChild {
+		dirs[filepath.Base(child.DirName)] = child
+	}
+	for _, child := range a.DirChild {
+		other, ok := dirs[filepath.Base(child.DirName)]
+		if !ok || !sameTree(child, other) {
+			return false
+		}
+	}
+	return true
+}
+
+//被删除目录的子树中不能有未同步的变更，否则远程内容与记录不一致
+func synced(dir *DirectoryStruct) bool {
+	for _, file := range dir.File {
+		if file.Status != NotModify {
+			return false
+		}
+	}
+	for _, child := range dir.DirChild {
+		if child.Status != NotModify || !synced(child) {
+			return false
+		}
+	}
+	return true
+}
+
+func markSynced(dir *DirectoryStruct) {
+	for _, file := range dir.File {
+		file.Status = NotModify
+	}
+	for _, child := range dir.DirChild {
+		markSynced(child)
+	}
+	dir.Status = NotModify
+}
@@ -0,0 +1,195 @@
+package dir
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+//状态文件格式
+const (
+	StateVersion = 2        //当前状态文件版本，1为EncodeJson直接输出的DirectoryStruct
+	FormatJson   = "json"
+	FormatBinary = "binary" //gob编码，文件以stateMagic开头
+	stateMagic   = "GASF"
+)
+
+//状态文件头
+type StateHeader struct {
+	Version  int       `json:"version"`
+	Project  string    `json:"project"`
+	BaseDir  string    `json:"base_dir"` //保存时的本地基目录，仅作记录，加载时以当前配置为准
+	SaveTime time.Time `json:"save_time"`
+}
+
+type state struct {
+	StateHeader
+	Root *dirNode `json:"root"`
+}
+
+//状态文件中的目录节点，只保存相对上级目录的名称，修改时间为UnixNano
+type dirNode struct {
+	Name       string      `json:"n"`
+	ModifyTime int64       `json:"t"`
+	Status     int         `json:"s,omitempty"`
+	Inode      uint64      `json:"i,omitempty"`
+	Dirs       []*dirNode  `json:"d,omitempty"`
+	Files      []*fileNode `json:"f,omitempty"`
+}
+
+type fileNode struct {
+	Name       string `json:"n"`
+	ModifyTime int64  `json:"t"`
+	Size       int64  `json:"z,omitempty"`
+	Status     int    `json:"s,omitempty"`
+	Inode      uint64 `json:"i,omitempty"`
+}
+
+//按指定格式保存目录状态
+func (d *Directory) Encode(w io.Writer, project, format string) error {
+	st := &state{
+		StateHeader: StateHeader{
+			Version:  StateVersion,
+			Project:  project,
+			BaseDir:  d.Dir.DirName,
+			SaveTime: time.Now(),
+		},
+		Root: toNode(d.Dir),
+	}
+	switch format {
+	case "", FormatJson:
+		return json.NewEncoder(w).Encode(st)
+	case FormatBinary:
+		if _, err := io.WriteString(w, stateMagic); err != nil {
+			return err
+		}
+		return gob.NewEncoder(w).Encode(st)
+	}
+	return fmt.Errorf("unknown state format:%s", format)
+}
+
+//加载目录状态，自动识别格式，返回状态文件的版本
+//版本1（EncodeJson输出的旧格式）会迁移为当前结构，所有路径以baseDir为基目录重建
+func (d *Directory) Decode(r io.Reader, project, baseDir string) (int, error) {
+	reader := bufio.NewReader(r)
+	head, _ := reader.Peek(len(stateMagic))
+	st := new(state)
+	if string(head) == stateMagic {
+		reader.Discard(len(stateMagic))
+		if err := gob.NewDecoder(reader).Decode(st); err != nil {
+			return 0, fmt.Errorf("decode binary state failed:%v", err)
+		}
+	} else {
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return 0, err
+		}
+		var header StateHeader
+		if err := json.Unmarshal(content, &header); err != nil {
+			return 0, fmt.Errorf("decode state failed:%v", err)
+		}
+		if header.Version == 0 {
+			legacy := New()
+			if err := legacy.DecodeJson(bytes.NewReader(content)); err != nil {
+				return 0, fmt.Errorf("decode legacy state failed:%v", err)
+			}
+			st.Version = 1
+			st.Project = project
+			st.Root = toNode(legacy.Dir)
+		} else if err := json.Unmarshal(content, st); err != nil {
+			return 0, fmt.Errorf("decode state failed:%v", err)
+		}
+	}
+	if st.Version > StateVersion {
+		return 0, fmt.Errorf("unsupported state version:%d", st.Version)
+	}
+	if st.Project != project {
+		return 0, fmt.Errorf("state belongs to project[%s], not [%s]", st.Project, project)
+	}
+	if st.Root == nil {
+		return 0, fmt.Errorf("state of project[%s] is empty", project)
+	}
+	d.Dir = fromNode(st.Root, baseDir)
+	d.DirMap = make(map[string]*DirectoryStruct)
+	fillDirIndex(d.Dir, d.DirMap)
+	if st.Version >= 2 { //版本2起记录了文件大小，大小为0时也需要比较
+		for _, dir := range d.DirMap {
+			for _, file := range dir.File {
+				file.sized = true
+			}
+		}
+	}
+	return st.Version, nil
+}
+
+func toNode(dir *DirectoryStruct) *dirNode {
+	n := &dirNode{
+		Name:       filepath.Base(dir.DirName),
+		ModifyTime: unixNano(dir.ModifyTime),
+		Status:     dir.Status,
+		Inode:      dir.Inode,
+	}
+	for _, child := range dir.DirChild {
+		if child.Status == ShiftDelete {
+			continue
+		}
+		n.Dirs = append(n.Dirs, toNode(child))
+	}
+	for _, file := range dir.File {
+		if file.Status == ShiftDelete {
+			continue
+		}
+		n.Files = append(n.Files, &fileNode{
+			Name:       filepath.Base(file.Name),
+			ModifyTime: unixNano(file.ModifyTime),
+			Size:       file.Size,
+			Status:     file.Status,
+			Inode:      file.Inode,
+		})
+	}
+	return n
+}
+
+func fromNode(n *dirNode, path string) *DirectoryStruct {
+	dir := &DirectoryStruct{
+		DirName:    path,
+		ModifyTime: fromUnixNano(n.ModifyTime),
+		Status:     n.Status,
+		Inode:      n.Inode,
+		DirChild:   make([]*DirectoryStruct, 0, len(n.Dirs)),
+		File:       make([]*FileStruct, 0, len(n.Files)),
+	}
+	for _, child := range n.Dirs {
+		dir.DirChild = append(dir.DirChild, fromNode(child, fmt.Sprintf("%s%c%s", path, filepath.Separator, child.Name)))
+	}
+	for _, file := range n.Files {
+		dir.File = append(dir.File, &FileStruct{
+			Name:       fmt.Sprintf("%s%c%s", path, filepath.Separator, file.Name),
+			ModifyTime: fromUnixNano(file.ModifyTime),
+			Size:       file.Size,
+			Status:     file.Status,
+			Inode:      file.Inode,
+		})
+	}
+	return dir
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
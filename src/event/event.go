@@ -0,0 +1,112 @@
+package event
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//事件类型
+const (
+	ScanStarted        = "scan_started"
+	ScanFinished       = "scan_finished"
+	ChangeDetected     = "change_detected"
+	UploadStarted      = "upload_started"
+	UploadProgress     = "upload_progress"
+	UploadCompleted    = "upload_completed"
+	UploadFailed       = "upload_failed"
+	ConnectionLost     = "connection_lost"
+	ConnectionRestored = "connection_restored"
+)
+
+const defaultBuffer = 256
+
+type Event struct {
+	Type    string    `json:"type"`
+	Project string    `json:"project"`
+	Time    time.Time `json:"time"`
+	Path    string    `json:"path,omitempty"`  //文件相对项目基目录的路径，以/分隔
+	Dirs    []string  `json:"dirs,omitempty"`  //检测到变更的目录（相对路径）
+	Bytes   int64     `json:"bytes,omitempty"` //已上传的字节数
+	Total   int64     `json:"total,omitempty"` //文件大小
+	Error   string    `json:"error,omitempty"`
+}
+
+//订阅者，project为空时接收所有项目的事件
+type Subscriber struct {
+	C       <-chan Event
+	ch      chan Event
+	project string
+	dropped uint64
+}
+
+//事件总线，发布不阻塞，订阅者处理不及时时丢弃事件
+type Bus struct {
+	lock        sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+}
+
+var DefaultBus = NewBus()
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+func (b *Bus) Subscribe(project string) *Subscriber {
+	ch := make(chan Event, defaultBuffer)
+	s := &Subscriber{
+		C:       ch,
+		ch:      ch,
+		project: project,
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+func (b *Bus) Unsubscribe(s *Subscriber) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.ch)
+	}
+}
+
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for s := range b.subscribers {
+		if s.project != "" && s.project != e.Project {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+//返回因处理不及时被丢弃的事件数
+func (s *Subscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func Subscribe(project string) *Subscriber {
+	return DefaultBus.Subscribe(project)
+}
+
+func Unsubscribe(s *Subscriber) {
+	DefaultBus.Unsubscribe(s)
+}
+
+func Publish(e Event) {
+	DefaultBus.Publish(e)
+}
@@ -0,0 +1,38 @@
+package event
+
+import (
+	"testing"
+)
+
+func TestBus_Publish(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe("")
+	demo := bus.Subscribe("demo")
+	bus.Publish(Event{Type: ScanStarted, Project: "demo"})
+	bus.Publish(Event{Type: ScanStarted, Project: "other"})
+	if len(all.C) != 2 {
+		t.Errorf("subscriber of all projects received %d events, expect 2", len(all.C))
+	}
+	if len(demo.C) != 1 {
+		t.Fatalf("subscriber of demo received %d events, expect 1", len(demo.C))
+	}
+	if e := <-demo.C; e.Project != "demo" || e.Time.IsZero() {
+		t.Errorf("unexpected event %+v", e)
+	}
+	bus.Unsubscribe(demo)
+	bus.Publish(Event{Type: ScanFinished, Project: "demo"})
+	if _, ok := <-demo.C; ok {
+		t.Errorf("unsubscribed channel should be closed")
+	}
+}
+
+func TestBus_Dropped(t *testing.T) {
+	bus := NewBus()
+	s := bus.Subscribe("")
+	for i := 0; i < defaultBuffer+10; i++ {
+		bus.Publish(Event{Type: UploadProgress, Project: "demo"})
+	}
+	if s.Dropped() != 10 {
+		t.Errorf("dropped %d events, expect 10", s.Dropped())
+	}
+}
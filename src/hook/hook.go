@@ -0,0 +1,84 @@
+package hook
+
+import (
+	"conf"
+	"fmt"
+	"path"
+	"sftp"
+	"strings"
+	"time"
+	"util"
+)
+
+//同步完成后在远程服务器上执行的钩子
+type Remote struct {
+	project string
+	hooks   []*conf.HookConfig
+}
+
+func NewRemote(project string, hooks []*conf.HookConfig) *Remote {
+	return &Remote{
+		project: project,
+		hooks:   hooks,
+	}
+}
+
+//依次执行与变更路径匹配的钩子，changed为相对local_base_dir、以/分隔的路径
+//只有配置了fail_sync的钩子执行失败时才返回错误，其余失败只记录日志
+func (r *Remote) Run(client sftp.Sftp, changed []string) error {
+	if len(changed) == 0 {
+		return nil
+	}
+	for _, h := range r.hooks {
+		if !Match(h.Paths, changed) {
+			continue
+		}
+		start := time.Now()
+		stdout, stderr, err := client.Run(h.Command, time.Duration(h.Timeout)*time.Second)
+		if len(stdout) != 0 {
+			util.Info("hook stdout", util.F("project", r.project), util.F("hook", h.Name), util.F("stdout", stdout))
+		}
+		if len(stderr) != 0 {
+			util.Info("hook stderr", util.F("project", r.project), util.F("hook", h.Name), util.F("stderr", stderr))
+		}
+		if err != nil {
+			util.Error("hook failed", util.F("project", r.project), util.F("hook", h.Name), util.F("command", h.Command), util.F("error", err))
+			if h.FailSync {
+				return fmt.Errorf("remote hook[%s] failed:%v", h.Name, err)
+			}
+			continue
+		}
+		util.Info("hook finish", util.F("project", r.project), util.F("hook", h.Name), util.F("command", h.Command), util.F("cost", time.Since(start)))
+	}
+	return nil
+}
+
+//判断变更路径是否命中匹配规则，规则为空时总是命中
+//  *.conf         匹配任意目录下的文件名
+//  nginx/*.conf   匹配相对路径
+//  nginx/         匹配该目录及其下所有路径
+func Match(patterns []string, changed []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range changed {
+		for _, pattern := range patterns {
+			if matchPath(pattern, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchPath(pattern, p string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return p == strings.TrimSuffix(pattern, "/") || strings.HasPrefix(p, pattern)
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
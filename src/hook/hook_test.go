@@ -0,0 +1,118 @@
+package hook
+
+import (
+	"compress/gzip"
+	"conf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	changed := []string{"public/index.php", "nginx/site.conf"}
+	cases := []struct {
+		patterns []string
+		expect   bool
+	}{
+		{nil, true},
+		{[]string{"*.conf"}, true},
+		{[]string{"*.js"}, false},
+		{[]string{"nginx/*.conf"}, true},
+		{[]string{"public/*.conf"}, false},
+		{[]string{"public/"}, true},
+		{[]string{"pub/"}, false},
+	}
+	for _, c := range cases {
+		if res := Match(c.patterns, changed); res != c.expect {
+			t.Errorf("Match(%v) = %v, expect %v", c.patterns, res, c.expect)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "config.php")
+	if err := ioutil.WriteFile(local, []byte("host=@DB_HOST@"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	tr := &conf.TransformConfig{Type: TransformTemplate, Vars: map[string]string{"@DB_HOST@": "10.0.0.1"}}
+	tmp, err := Transform(tr, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp)
+	content, _ := ioutil.ReadFile(tmp)
+	if string(content) != "host=10.0.0.1" {
+		t.Errorf("template result:%s", content)
+	}
+
+	//占位符互为前缀时优先替换较长的
+	vars := filepath.Join(filepath.Dir(local), "vars.php")
+	ioutil.WriteFile(vars, []byte("host=@DB_HOST@ db=@DB"), 0666)
+	tr = &conf.TransformConfig{Type: TransformTemplate, Vars: map[string]string{"@DB": "app", "@DB_HOST@": "10.0.0.1", "@D": "-"}}
+	for i := 0; i < 10; i++ {
+		tmp, err := Transform(tr, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadFile(tmp)
+		os.Remove(tmp)
+		if string(content) != "host=10.0.0.1 db=app" {
+			t.Fatalf("template result:%s", content)
+		}
+	}
+
+	tr = &conf.TransformConfig{Type: TransformGzip}
+	tmp, err = Transform(tr, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp)
+	fp, _ := os.Open(tmp)
+	defer fp.Close()
+	r, err := gzip.NewReader(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ = ioutil.ReadAll(r)
+	if string(content) != "host=@DB_HOST@" {
+		t.Errorf("gzip result:%s", content)
+	}
+}
+
+func TestTransform_CommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh not available")
+	}
+	local := filepath.Join(t.TempDir(), "index.tpl")
+	ioutil.WriteFile(local, []byte("tpl"), 0666)
+	tr := &conf.TransformConfig{Type: TransformCommand, Command: "sleep 10", Timeout: 1}
+	start := time.Now()
+	if _, err := Transform(tr, local); err == nil {
+		t.Error("expect timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("transform command not killed after timeout, elapsed %v", elapsed)
+	}
+}
+
+func TestLocal_Run(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh not available")
+	}
+	dir := t.TempDir()
+	hooks := []*conf.HookConfig{{Name: "ok", Command: "cat > changed.txt"}}
+	if err := NewLocal("test", dir, hooks).Run([]string{"/a", "/b"}, []string{"a", "b"}); err != nil {
+		t.Error(err)
+	}
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "changed.txt"))
+	if string(content) != "/a\n/b" {
+		t.Errorf("changed paths:%q", content)
+	}
+	hooks = append(hooks, &conf.HookConfig{Name: "fail", Command: "exit 1"})
+	if err := NewLocal("test", dir, hooks).Run([]string{"/a"}, []string{"a"}); err == nil {
+		t.Error("expect failed hook to abort")
+	}
+}
@@ -0,0 +1,81 @@
+package hook
+
+import (
+	"bytes"
+	"conf"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+	"util"
+)
+
+//上传前在本地执行的钩子，任意钩子失败都会中止本轮同步
+type Local struct {
+	project string
+	dir     string
+	hooks   []*conf.HookConfig
+}
+
+func NewLocal(project, dir string, hooks []*conf.HookConfig) *Local {
+	return &Local{
+		project: project,
+		dir:     dir,
+		hooks:   hooks,
+	}
+}
+
+//changed为CheckModify返回的变更目录，rel为对应的相对路径，用于匹配规则
+//钩子在本地基目录下执行，变更目录通过标准输入（每行一个）以及环境变量SYNC_CHANGED_PATHS传入
+func (l *Local) Run(changed []string, rel []string) error {
+	for _, h := range l.hooks {
+		if !Match(h.Paths, rel) {
+			continue
+		}
+		start := time.Now()
+		cmd, cancel := command(h.Command, time.Duration(h.Timeout)*time.Second)
+		cmd.Dir = l.dir
+		cmd.Env = append(os.Environ(),
+			fmt.Sprint("SYNC_PROJECT=", l.project),
+			fmt.Sprint("SYNC_CHANGED_PATHS=", strings.Join(changed, string(os.PathListSeparator))))
+		cmd.Stdin = strings.NewReader(strings.Join(changed, "\n"))
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		cancel()
+		if stdout.Len() != 0 {
+			util.Info("hook stdout", util.F("project", l.project), util.F("hook", h.Name), util.F("stdout", stdout.String()))
+		}
+		if stderr.Len() != 0 {
+			util.Info("hook stderr", util.F("project", l.project), util.F("hook", h.Name), util.F("stderr", stderr.String()))
+		}
+		if err != nil {
+			util.Error("hook failed", util.F("project", l.project), util.F("hook", h.Name), util.F("command", h.Command), util.F("error", err))
+			return fmt.Errorf("pre hook[%s] failed:%v", h.Name, err)
+		}
+		util.Info("hook finish", util.F("project", l.project), util.F("hook", h.Name), util.F("command", h.Command), util.F("cost", time.Since(start)))
+	}
+	return nil
+}
+
+//通过系统shell执行命令，timeout小于等于0时不限制执行时间
+func command(line string, timeout time.Duration) (*exec.Cmd, context.CancelFunc) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", line)
+	}else{
+		cmd = exec.CommandContext(ctx, "sh", "-c", line)
+	}
+	//超时只会结束shell，子进程仍持有输出管道时最多再等待WaitDelay
+	cmd.WaitDelay = time.Second
+	return cmd, cancel
+}
@@ -0,0 +1,160 @@
+package hook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"conf"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sftp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	TransformGzip     = "gzip"
+	TransformTemplate = "template"
+	TransformCommand  = "command"
+)
+
+//转换命令的默认超时时间，上传时持有目录锁，不能无限等待
+const defaultTransformTimeout = 60 * time.Second
+
+//在上传前对文件进行转换的sftp客户端，其余操作直接交给被包装的客户端
+type transformClient struct {
+	sftp.Sftp
+	transforms []*conf.TransformConfig
+}
+
+//包装sftp客户端，未配置转换时直接返回原客户端
+func NewTransform(client sftp.Sftp, transforms []*conf.TransformConfig) sftp.Sftp {
+	if len(transforms) == 0 {
+		return client
+	}
+	return &transformClient{
+		Sftp:       client,
+		transforms: transforms,
+	}
+}
+
+func (t *transformClient) Put(local, remote string) error {
+	tr := t.match(filepath.Base(local))
+	if tr == nil {
+		return t.Sftp.Put(local, remote)
+	}
+	tmp, err := Transform(tr, local)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return t.Sftp.Put(tmp, remote+tr.Suffix)
+}
+
+//删除远程文件时同样需要加上转换后缀
+func (t *transformClient) Remove(remote string) error {
+	if tr := t.match(path.Base(remote)); tr != nil {
+		return t.Sftp.Remove(remote + tr.Suffix)
+	}
+	return t.Sftp.Remove(remote)
+}
+
+//重命名前后匹配的转换不同时远程内容无法直接复用，返回错误由调用方重新上传
+func (t *transformClient) Rename(oldRemote, newRemote string) error {
+	oldTr, newTr := t.match(path.Base(oldRemote)), t.match(path.Base(newRemote))
+	if oldTr != newTr {
+		return fmt.Errorf("transform of %s and %s mismatch", oldRemote, newRemote)
+	}
+	if oldTr != nil {
+		oldRemote += oldTr.Suffix
+		newRemote += newTr.Suffix
+	}
+	return t.Sftp.Rename(oldRemote, newRemote)
+}
+
+func (t *transformClient) match(name string) *conf.TransformConfig {
+	return MatchTransform(t.transforms, name)
+}
+
+//按配置顺序返回第一个匹配文件名的转换，没有匹配时返回nil
+func MatchTransform(transforms []*conf.TransformConfig, name string) *conf.TransformConfig {
+	for _, tr := range transforms {
+		if ok, _ := path.Match(tr.Pattern, name); ok {
+			return tr
+		}
+	}
+	return nil
+}
+
+//将local按配置转换后写入临时文件，返回临时文件名，由调用方负责删除
+func Transform(tr *conf.TransformConfig, local string) (string, error) {
+	src, err := os.Open(local)
+	if err != nil {
+		return "", fmt.Errorf("Open %s failed:%v", local, err)
+	}
+	defer src.Close()
+	dst, err := ioutil.TempFile("", "transform_")
+	if err != nil {
+		return "", fmt.Errorf("create temp file failed:%v", err)
+	}
+	switch tr.Type {
+	case TransformGzip:
+		w := gzip.NewWriter(dst)
+		if _, err = io.Copy(w, src); err == nil {
+			err = w.Close()
+		}
+	case TransformTemplate:
+		var content []byte
+		if content, err = ioutil.ReadAll(src); err == nil {
+			_, err = templateReplacer(tr.Vars).WriteString(dst, string(content))
+		}
+	case TransformCommand:
+		stderr := new(bytes.Buffer)
+		timeout := defaultTransformTimeout
+		if tr.Timeout > 0 {
+			timeout = time.Duration(tr.Timeout) * time.Second
+		}
+		cmd, cancel := command(tr.Command, timeout)
+		cmd.Stdin = src
+		cmd.Stdout = dst
+		cmd.Stderr = stderr
+		if err = cmd.Run(); err != nil && stderr.Len() != 0 {
+			err = fmt.Errorf("%v, stderr:%s", err, stderr.String())
+		}
+		cancel()
+	default:
+		err = fmt.Errorf("unknown transform type:%s", tr.Type)
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", fmt.Errorf("transform %s failed:%v", local, err)
+	}
+	return dst.Name(), nil
+}
+
+//占位符按长度从长到短、相同长度按字典序排列，
+//占位符互为前缀时（如@DB和@DB_HOST@）优先替换较长的，结果不受map遍历顺序影响
+func templateReplacer(vars map[string]string) *strings.Replacer {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	pairs := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key, vars[key])
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -0,0 +1,283 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//传输操作
+const (
+	OpPut    = "put"
+	OpMkdir  = "mkdir"
+	OpRemove = "remove"
+	OpRmdir  = "rmdir"
+	OpRename = "rename"
+)
+
+//传输结果
+const (
+	ResultOk    = "ok"
+	ResultError = "error"
+)
+
+const (
+	DefaultMaxSize  = 10 * 1024 * 1024 //单个文件的默认大小上限
+	DefaultMaxFiles = 5                //默认保留的历史文件数
+)
+
+//一次远程操作的记录，每条记录为一行JSON
+type Record struct {
+	Time     time.Time `json:"time"`
+	Cycle    string    `json:"cycle"`              //同步轮次，同一轮同步的记录相同
+	Op       string    `json:"op"`
+	Path     string    `json:"path"`               //相对项目基目录，以/分隔
+	Remote   string    `json:"remote"`             //远程路径，重命名时为新路径
+	From     string    `json:"from,omitempty"`     //重命名前的远程路径
+	Size     int64     `json:"size,omitempty"`     //上传的字节数
+	Duration int64     `json:"duration_ms"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+}
+
+//查询条件，零值表示不限制
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Path   string //包含通配符时按path.Match匹配，否则匹配该路径及其下的所有路径
+	Op     string
+	Result string
+	Cycle  string
+	Limit  int    //最多返回的记录数，最新的优先
+}
+
+func (f *Filter) match(r *Record) bool {
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.Time.Before(f.Until) {
+		return false
+	}
+	if len(f.Op) != 0 && f.Op != r.Op {
+		return false
+	}
+	if len(f.Result) != 0 && f.Result != r.Result {
+		return false
+	}
+	if len(f.Cycle) != 0 && f.Cycle != r.Cycle {
+		return false
+	}
+	if p := strings.Trim(f.Path, "/"); len(p) != 0 {
+		if strings.ContainsAny(p, "*?[") {
+			ok, _ := path.Match(p, r.Path)
+			return ok
+		}
+		return r.Path == p || strings.HasPrefix(r.Path, p+"/")
+	}
+	return true
+}
+
+//追加写入的传输日志，当前文件超过maxSize时依次重命名为file.1、file.2……，最多保留maxFiles个历史文件
+type Journal struct {
+	file     string
+	maxSize  int64
+	maxFiles int
+	lock     sync.Mutex
+	fp       *os.File
+	size     int64
+	rotation uint64 //开始和结束轮转时各加1，原子更新，查询时判断读取期间是否发生了轮转
+}
+
+//查询期间发生轮转时的最大重试次数
+const queryRetry = 3
+
+func Open(file string, maxSize int64, maxFiles int) (*Journal, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	j := &Journal{
+		file:     file,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) open() error {
+	fp, err := os.OpenFile(j.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	j.fp, j.size = fp, info.Size()
+	return nil
+}
+
+func (j *Journal) File() string {
+	return j.file
+}
+
+func (j *Journal) Append(records ...Record) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.fp == nil {
+		return fmt.Errorf("journal %s closed", j.file)
+	}
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if j.size > 0 && j.size+int64(len(line)) > j.maxSize {
+			if err := j.rotate(); err != nil {
+				return err
+			}
+		}
+		n, err := j.fp.Write(line)
+		j.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *Journal) rotate() error {
+	atomic.AddUint64(&j.rotation, 1) //轮转期间为奇数
+	defer atomic.AddUint64(&j.rotation, 1)
+	if err := j.fp.Close(); err != nil {
+		return err
+	}
+	j.fp = nil
+	os.Remove(rotated(j.file, j.maxFiles))
+	for i := j.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(rotated(j.file, i), rotated(j.file, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(j.file, rotated(j.file, 1)); err != nil {
+		return err
+	}
+	return j.open()
+}
+
+//解析文件时不持有锁，避免阻塞Append，读取期间发生轮转时文件名已变化，结果可能重复或缺失，重新读取
+func (j *Journal) Query(filter Filter) ([]Record, error) {
+	for i := 0; ; i++ {
+		rotation := atomic.LoadUint64(&j.rotation)
+		res, err := Read(j.file, filter)
+		if (rotation%2 == 0 && rotation == atomic.LoadUint64(&j.rotation)) || i >= queryRetry {
+			return res, err
+		}
+	}
+}
+
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.fp == nil {
+		return nil
+	}
+	err := j.fp.Close()
+	j.fp = nil
+	return err
+}
+
+func rotated(file string, i int) string {
+	return fmt.Sprintf("%s.%d", file, i)
+}
+
+//读取日志文件及其历史文件中符合条件的记录，最新的在前，无法解析的行忽略
+//不需要打开Journal，可用于离线查询
+func Read(file string, filter Filter) ([]Record, error) {
+	files := []string{file}
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotated(file, i)); err != nil {
+			break
+		}
+		files = append(files, rotated(file, i))
+	}
+	res := make([]Record, 0)
+	for _, f := range files {
+		records, err := readFile(f, &filter)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		//文件内按时间先后追加，倒序后最新的在前
+		for i := len(records) - 1; i >= 0; i-- {
+			res = append(res, records[i])
+		}
+		if filter.Limit > 0 && len(res) >= filter.Limit {
+			break
+		}
+	}
+	sort.SliceStable(res, func(a, b int) bool {
+		return res[a].Time.After(res[b].Time)
+	})
+	if filter.Limit > 0 && len(res) > filter.Limit {
+		res = res[:filter.Limit]
+	}
+	return res, nil
+}
+
+func readFile(file string, filter *Filter) ([]Record, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	records := make([]Record, 0)
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if filter.match(&r) {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+//解析查询的时间：RFC3339、2006-01-02 15:04:05、2006-01-02，或者相对now的时长如30m、24h
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time:%s", s)
+}
@@ -0,0 +1,147 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal_Rotate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.journal")
+	j, err := Open(file, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		r := Record{Time: start.Add(time.Duration(i) * time.Minute), Cycle: "c1", Op: OpPut, Path: "a.txt", Result: ResultOk}
+		if err := j.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{file, file + ".1", file + ".2"} {
+		info, err := os.Stat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 300 {
+			t.Errorf("%s size %d exceeds max size", f, info.Size())
+		}
+	}
+	if _, err := os.Stat(file + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expect at most 2 rotated files, err:%v", err)
+	}
+	records, err := j.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || len(records) >= 20 {
+		t.Fatalf("unexpected record count %d", len(records))
+	}
+	if !records[0].Time.Equal(start.Add(19 * time.Minute)) {
+		t.Errorf("newest record should be first, got %v", records[0].Time)
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].Time.After(records[i-1].Time) {
+			t.Fatalf("records not sorted at %d", i)
+		}
+	}
+}
+
+func TestRead_Filter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.journal")
+	j, err := Open(file, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = j.Append(
+		Record{Time: start, Cycle: "c1", Op: OpMkdir, Path: "css", Result: ResultOk},
+		Record{Time: start.Add(time.Second), Cycle: "c1", Op: OpPut, Path: "css/a.css", Size: 10, Result: ResultOk},
+		Record{Time: start.Add(time.Hour), Cycle: "c2", Op: OpPut, Path: "js/b.js", Result: ResultError, Error: "broken pipe"},
+		Record{Time: start.Add(2 * time.Hour), Cycle: "c3", Op: OpRemove, Path: "cssx/c.css", Result: ResultOk},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	if err := j.Append(Record{}); err == nil {
+		t.Errorf("append after close should fail")
+	}
+	tests := []struct {
+		filter Filter
+		expect []string
+	}{
+		{Filter{}, []string{"cssx/c.css", "js/b.js", "css/a.css", "css"}},
+		{Filter{Path: "css"}, []string{"css/a.css", "css"}},
+		{Filter{Path: "*/*.css"}, []string{"cssx/c.css", "css/a.css"}},
+		{Filter{Result: ResultError}, []string{"js/b.js"}},
+		{Filter{Op: OpPut}, []string{"js/b.js", "css/a.css"}},
+		{Filter{Cycle: "c1"}, []string{"css/a.css", "css"}},
+		{Filter{Since: start.Add(time.Second), Until: start.Add(2 * time.Hour)}, []string{"js/b.js", "css/a.css"}},
+		{Filter{Limit: 1}, []string{"cssx/c.css"}},
+	}
+	for _, test := range tests {
+		records, err := Read(file, test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths := make([]string, 0, len(records))
+		for _, r := range records {
+			paths = append(paths, r.Path)
+		}
+		if len(paths) != len(test.expect) {
+			t.Errorf("filter %+v got %v, expect %v", test.filter, paths, test.expect)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != test.expect[i] {
+				t.Errorf("filter %+v got %v, expect %v", test.filter, paths, test.expect)
+				break
+			}
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	if v, err := ParseTime("1h", now); err != nil || !v.Equal(now.Add(-time.Hour)) {
+		t.Errorf("parse duration got %v %v", v, err)
+	}
+	if v, err := ParseTime("2024-01-01T08:00:00Z", now); err != nil || !v.Equal(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("parse rfc3339 got %v %v", v, err)
+	}
+	if v, err := ParseTime("", now); err != nil || !v.IsZero() {
+		t.Errorf("empty time should be zero, got %v %v", v, err)
+	}
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Errorf("invalid time should fail")
+	}
+}
+
+//查询不持有追加写入的锁
+func TestJournal_QueryUnlocked(t *testing.T) {
+	j, err := Open(filepath.Join(t.TempDir(), "demo.journal"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	j.Append(Record{Time: time.Now(), Op: OpPut, Path: "a.txt", Result: ResultOk})
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	done := make(chan int, 1)
+	go func() {
+		records, _ := j.Query(Filter{})
+		done <- len(records)
+	}()
+	select {
+	case n := <-done:
+		if n != 1 {
+			t.Errorf("query returned %d records", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("query blocked by append lock")
+	}
+}
@@ -12,33 +12,57 @@ import (
 	"web"
 )
 
-func wait(){
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGQUIT, syscall.SIGKILL,syscall.SIGABRT, syscall.SIGTERM,syscall.SIGINT)
-	<- ch
-}
-
 func main(){
-	config,err := conf.InitConfig()
+	if len(os.Args) >= 2 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	file := conf.ConfigFile()
+	config,err := conf.LoadConfig(file)
 	if err != nil {
 		log.Fatalln("init configure failed, errMsg:", err)
 	}
-	projects := make(map[string]*project.Project)
-	for _, conf := range config.Conf {
-		if conf.Switch != "on" {
-			continue
-		}
-		p, err := project.Open(conf)
-		if err != nil {
-			util.LogPrint("Start", util.E, "main",p.ProjectName,fmt.Sprint(p.ProjectName, " start failed, err:", err))
-			continue
-		}
-		projects[conf.Name] = p
+	if err := config.Validate(); err != nil {
+		log.Fatalln("invalid configure", file+",", err)
+	}
+	if err := util.ConfigureLog(config.Log); err != nil {
+		log.Fatalln("init log failed, errMsg:", err)
 	}
-	go web.WebServerStart(projects)
-	wait()
-	for _, p := range projects {
-		p.Close()
+	defer util.CloseLog()
+	projects := project.NewProjects()
+	d := &daemon{
+		file:    file,
+		config:  config,
+		manager: project.NewManager(projects),
+	}
+	//项目在单独的goroutine中启动，启动期间仍然可以处理退出信号
+	reloads := make(chan string, 1)
+	done := make(chan struct{})
+	go d.run(reloads, done)
+	go web.WebServerStart(projects, config.Web)
+	changed := make(chan struct{}, 1)
+	go watchConfig(file, config.ReloadInterval, changed)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGABRT, syscall.SIGTERM, syscall.SIGINT)
+	for running := true; running; {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				notify(reloads, "SIGHUP")
+			}else{
+				util.Info("signal received, stopping", util.F("signal", sig))
+				running = false
+			}
+		case <-changed:
+			notify(reloads, "file changed")
+		}
 	}
-	fmt.Println("auto-upload-file finish")
+	close(done)
+	d.manager.Close()
+	util.Info("auto-upload-file finish")
 }
@@ -0,0 +1,93 @@
+package mapping
+
+import (
+	"conf"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//本地路径到远程路径的映射
+//默认远程路径为remote_base_dir + 本地基目录名 + 相对路径，strip_base_dir时不包含本地基目录名
+//path_mappings按最长前缀匹配相对路径，命中后使用对应的远程根目录
+//rename_rules依次作用于映射根目录之下的相对路径
+type Mapper struct {
+	localBaseDir string
+	localSep     string
+	remoteSep    string
+	root         string
+	mappings     []*conf.PathMapping
+	renames      []*rename
+}
+
+type rename struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+func New(config *conf.ProjectConfig, localSep, remoteSep string) (*Mapper, error) {
+	m := &Mapper{
+		localBaseDir: strings.TrimSuffix(config.LocalBaseDir, localSep),
+		localSep:     localSep,
+		remoteSep:    remoteSep,
+		root:         strings.TrimSuffix(config.RemoteBaseDir, remoteSep),
+	}
+	if !config.StripBaseDir {
+		base := m.localBaseDir[strings.LastIndex(m.localBaseDir, localSep)+len(localSep):]
+		m.root = strings.Join([]string{m.root, base}, remoteSep)
+	}
+	for _, mapping := range config.PathMappings {
+		m.mappings = append(m.mappings, &conf.PathMapping{
+			Local:  strings.Trim(mapping.Local, "/"),
+			Remote: strings.TrimSuffix(mapping.Remote, remoteSep),
+		})
+	}
+	//最长前缀优先
+	sort.SliceStable(m.mappings, func(i, j int) bool {
+		return len(m.mappings[i].Local) > len(m.mappings[j].Local)
+	})
+	for _, rule := range config.RenameRules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rename rule[%s]:%v", rule.Pattern, err)
+		}
+		m.renames = append(m.renames, &rename{re: re, replace: rule.Replace})
+	}
+	return m, nil
+}
+
+//返回相对本地基目录、以/分隔的路径，基目录本身返回空串，不在基目录下的路径返回false
+func (m *Mapper) Relative(local string) (string, bool) {
+	if local != m.localBaseDir && !strings.HasPrefix(local, m.localBaseDir+m.localSep) {
+		return "", false
+	}
+	rel := strings.Trim(local[len(m.localBaseDir):], m.localSep)
+	return strings.Join(strings.Split(rel, m.localSep), "/"), true
+}
+
+//返回本地路径对应的远程路径
+func (m *Mapper) Remote(local string) string {
+	rel, ok := m.Relative(local)
+	if !ok {
+		return ""
+	}
+	root := m.root
+	for _, mapping := range m.mappings {
+		if rel == mapping.Local {
+			root, rel = mapping.Remote, ""
+			break
+		}
+		if mapping.Local == "" || strings.HasPrefix(rel, mapping.Local+"/") {
+			root, rel = mapping.Remote, strings.TrimPrefix(rel[len(mapping.Local):], "/")
+			break
+		}
+	}
+	if len(rel) == 0 {
+		return root
+	}
+	for _, r := range m.renames {
+		rel = r.re.ReplaceAllString(rel, r.replace)
+	}
+	return strings.Join(append([]string{root}, strings.Split(rel, "/")...), m.remoteSep)
+}
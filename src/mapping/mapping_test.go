@@ -0,0 +1,57 @@
+package mapping
+
+import (
+	"conf"
+	"testing"
+)
+
+func TestMapper_Remote(t *testing.T) {
+	config := &conf.ProjectConfig{
+		LocalBaseDir:  `E:\workspace\site`,
+		RemoteBaseDir: "/home/valvrave/",
+	}
+	m, err := New(config, `\`, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		`E:\workspace\site`:               "/home/valvrave/site",
+		`E:\workspace\site\public\a.html`: "/home/valvrave/site/public/a.html",
+		`E:\workspace\site2\a.html`:       "",
+	}
+	for local, expect := range cases {
+		if remote := m.Remote(local); remote != expect {
+			t.Errorf("Remote(%s) = %s, expect %s", local, remote, expect)
+		}
+	}
+
+	config.StripBaseDir = true
+	config.PathMappings = []*conf.PathMapping{
+		{Local: "public", Remote: "/var/www/html"},
+		{Local: "config/", Remote: "/etc/site/"},
+		{Local: "config/nginx", Remote: "/etc/nginx/conf.d"},
+	}
+	config.RenameRules = []*conf.RenameRule{{Pattern: `\.prod\.conf$`, Replace: ".conf"}}
+	if m, err = New(config, `\`, "/"); err != nil {
+		t.Fatal(err)
+	}
+	cases = map[string]string{
+		`E:\workspace\site`:                             "/home/valvrave",
+		`E:\workspace\site\README.md`:                   "/home/valvrave/README.md",
+		`E:\workspace\site\public`:                      "/var/www/html",
+		`E:\workspace\site\public\css\a.css`:            "/var/www/html/css/a.css",
+		`E:\workspace\site\publicity\a.html`:            "/home/valvrave/publicity/a.html",
+		`E:\workspace\site\config\app.prod.conf`:        "/etc/site/app.conf",
+		`E:\workspace\site\config\nginx\site.prod.conf`: "/etc/nginx/conf.d/site.conf",
+	}
+	for local, expect := range cases {
+		if remote := m.Remote(local); remote != expect {
+			t.Errorf("Remote(%s) = %s, expect %s", local, remote, expect)
+		}
+	}
+
+	config.RenameRules = []*conf.RenameRule{{Pattern: `(`}}
+	if _, err = New(config, `\`, "/"); err == nil {
+		t.Error("expect invalid rename rule error")
+	}
+}
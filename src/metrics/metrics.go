@@ -0,0 +1,332 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//默认的直方图分桶，单位秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+//指标注册表，按注册顺序以Prometheus文本格式输出
+type Registry struct {
+	lock       sync.Mutex
+	collectors []collector
+}
+
+var DefaultRegistry = new(Registry)
+
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.lock.Unlock()
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.Flush()
+}
+
+func WriteText(w io.Writer) error {
+	return DefaultRegistry.WriteText(w)
+}
+
+//指标名称、说明、类型和标签名
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d *desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.typ)
+}
+
+//标签值以\xff连接作为序列的key
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+//格式化标签，extra为直方图的le等附加标签
+func (d *desc) labelString(values []string, extra ...string) string {
+	if len(values) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, value := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", d.labels[i], escape(value)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escape(extra[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//计数器，只增不减
+type CounterVec struct {
+	desc
+	lock   sync.Mutex
+	values map[string]float64
+	series map[string][]string //key对应的标签值
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, typ: "counter", labels: labels},
+		values: make(map[string]float64),
+		series: make(map[string][]string),
+	}
+	DefaultRegistry.register(c)
+	return c
+}
+
+func (c *CounterVec) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	key := c.key(values)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.series[key]; !ok {
+		c.series[key] = append([]string(nil), values...)
+	}
+	c.values[key] += v
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) Value(values ...string) float64 {
+	key := c.key(values)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.values[key]
+}
+
+//删除项目停止后不再更新的序列
+func (c *CounterVec) Delete(values ...string) {
+	key := c.key(values)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.values, key)
+	delete(c.series, key)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.header(w)
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(c.series[key]), formatFloat(c.values[key]))
+	}
+}
+
+//仪表，可以设置为固定值或在输出时计算
+type GaugeVec struct {
+	desc
+	lock   sync.Mutex
+	values map[string]float64
+	funcs  map[string]func() float64
+	series map[string][]string
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		desc:   desc{name: name, help: help, typ: "gauge", labels: labels},
+		values: make(map[string]float64),
+		funcs:  make(map[string]func() float64),
+		series: make(map[string][]string),
+	}
+	DefaultRegistry.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(v float64, values ...string) {
+	key := g.key(values)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.series[key] = append([]string(nil), values...)
+	g.values[key] = v
+	delete(g.funcs, key)
+}
+
+func (g *GaugeVec) SetFunc(fn func() float64, values ...string) {
+	key := g.key(values)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.series[key] = append([]string(nil), values...)
+	g.funcs[key] = fn
+}
+
+func (g *GaugeVec) Value(values ...string) float64 {
+	key := g.key(values)
+	g.lock.Lock()
+	fn, ok := g.funcs[key]
+	v := g.values[key]
+	g.lock.Unlock()
+	if ok {
+		return fn()
+	}
+	return v
+}
+
+func (g *GaugeVec) Delete(values ...string) {
+	key := g.key(values)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	delete(g.values, key)
+	delete(g.funcs, key)
+	delete(g.series, key)
+}
+
+//计算函数在锁外调用，函数内可以加其他锁而不会与Set形成死锁
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.lock.Lock()
+	keys := sortedKeys(g.series)
+	series := make([][]string, len(keys))
+	values := make([]float64, len(keys))
+	funcs := make([]func() float64, len(keys))
+	for i, key := range keys {
+		series[i] = g.series[key]
+		values[i] = g.values[key]
+		funcs[i] = g.funcs[key]
+	}
+	g.lock.Unlock()
+	g.header(w)
+	for i := range keys {
+		v := values[i]
+		if funcs[i] != nil {
+			v = funcs[i]()
+		}
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelString(series[i]), formatFloat(v))
+	}
+}
+
+type histogram struct {
+	counts []uint64 //每个分桶（不累加）的计数，最后一个为+Inf
+	sum    float64
+	count  uint64
+}
+
+//直方图，buckets为各分桶的上界
+type HistogramVec struct {
+	desc
+	buckets []float64
+	lock    sync.Mutex
+	values  map[string]*histogram
+	series  map[string][]string
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+		series:  make(map[string][]string),
+	}
+	DefaultRegistry.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := h.key(values)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.values[key] = hist
+		h.series[key] = append([]string(nil), values...)
+	}
+	hist.counts[sort.SearchFloat64s(h.buckets, v)]++
+	hist.sum += v
+	hist.count++
+}
+
+//返回观测次数和总和
+func (h *HistogramVec) Value(values ...string) (uint64, float64) {
+	key := h.key(values)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if hist, ok := h.values[key]; ok {
+		return hist.count, hist.sum
+	}
+	return 0, 0
+}
+
+func (h *HistogramVec) Delete(values ...string) {
+	key := h.key(values)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.values, key)
+	delete(h.series, key)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.header(w)
+	for _, key := range sortedKeys(h.series) {
+		values := h.series[key]
+		hist := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(values, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(values), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(values), hist.count)
+	}
+}
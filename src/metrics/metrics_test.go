@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	counter := NewCounterVec("test_changes_total", "Detected changes.", "project", "type")
+	counter.Inc("demo", "add")
+	counter.Add(2, "demo", "add")
+	counter.Inc(`a"b`, "delete")
+	gauge := NewGaugeVec("test_pending", "Pending dirs.", "project")
+	gauge.Set(3, "demo")
+	gauge.SetFunc(func() float64 { return 1.5 }, "other")
+	histogram := NewHistogramVec("test_duration_seconds", "Duration.", []float64{0.1, 1}, "project")
+	histogram.Observe(0.05, "demo")
+	histogram.Observe(0.5, "demo")
+	histogram.Observe(5, "demo")
+
+	buf := new(bytes.Buffer)
+	if err := WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+	expects := []string{
+		"# TYPE test_changes_total counter\n",
+		`test_changes_total{project="demo",type="add"} 3` + "\n",
+		`test_changes_total{project="a\"b",type="delete"} 1` + "\n",
+		"# TYPE test_pending gauge\n",
+		`test_pending{project="demo"} 3` + "\n",
+		`test_pending{project="other"} 1.5` + "\n",
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{project="demo",le="0.1"} 1` + "\n",
+		`test_duration_seconds_bucket{project="demo",le="1"} 2` + "\n",
+		`test_duration_seconds_bucket{project="demo",le="+Inf"} 3` + "\n",
+		`test_duration_seconds_sum{project="demo"} 5.55` + "\n",
+		`test_duration_seconds_count{project="demo"} 3` + "\n",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("output missing %q:\n%s", expect, buf.String())
+		}
+	}
+
+	gauge.Delete("other")
+	buf.Reset()
+	WriteText(buf)
+	if strings.Contains(buf.String(), `test_pending{project="other"}`) {
+		t.Errorf("deleted series still present")
+	}
+}
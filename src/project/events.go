@@ -0,0 +1,62 @@
+package project
+
+import (
+	"event"
+	"sftp"
+	"time"
+)
+
+const progressInterval = 500 * time.Millisecond //同一文件上传进度事件的最小间隔
+
+func (p *Project) publish(typ string, e event.Event) {
+	e.Type = typ
+	e.Project = p.ProjectName
+	event.Publish(e)
+}
+
+//上传进度回调，经过转换的文件local为临时文件，因此使用当前上传的文件路径
+func (p *Project) progress(local string, written, total int64) {
+	p.sent = written
+	now := time.Now()
+	if written < total && now.Sub(p.lastProgress) < progressInterval {
+		return
+	}
+	p.lastProgress = now
+	p.publish(event.UploadProgress, event.Event{Path: p.uploading, Bytes: written, Total: total})
+}
+
+//发布文件上传事件的客户端，上传在dirLock保护下顺序进行
+type eventClient struct {
+	sftp.Sftp
+	project *Project
+}
+
+func newEventClient(p *Project, client sftp.Sftp) sftp.Sftp {
+	return &eventClient{
+		Sftp:    client,
+		project: p,
+	}
+}
+
+func (c *eventClient) Put(local, remote string) error {
+	p := c.project
+	p.uploading, _ = p.mapper.Relative(local)
+	p.lastProgress = time.Time{}
+	p.sent = -1
+	p.publish(event.UploadStarted, event.Event{Path: p.uploading})
+	start := time.Now()
+	err := c.Sftp.Put(local, remote)
+	uploadDuration.Observe(time.Since(start).Seconds(), p.ProjectName)
+	if err != nil {
+		p.publish(event.UploadFailed, event.Event{Path: p.uploading, Error: err.Error()})
+	}else{
+		p.publish(event.UploadCompleted, event.Event{Path: p.uploading})
+	}
+	p.uploading = ""
+	return err
+}
+
+//上传的文件转换后实际发送的字节数，由进度回调记录，未启用传输日志时统计也以其为准
+func (c *eventClient) LastSent() int64 {
+	return c.project.sent
+}
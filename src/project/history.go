@@ -0,0 +1,47 @@
+package project
+
+import (
+	"time"
+)
+
+const historySize = 100 //每个项目在内存中保留的传输记录数
+
+//一轮同步的传输记录
+type Transfer struct {
+	Time     time.Time `json:"time"`
+	Cycle    string    `json:"cycle"`            //同步轮次，对应传输日志中的cycle
+	Duration int64     `json:"duration_ms"`
+	Dirs     []string  `json:"dirs"`             //本轮检测到变更的目录（相对路径）
+	Paths    []string  `json:"paths"`            //实际上传、删除或重命名的路径（相对路径）
+	Error    string    `json:"error,omitempty"`
+}
+
+//返回最近的传输记录，最新的在前
+func (p *Project) History() []Transfer {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+	res := make([]Transfer, 0, len(p.history))
+	for i := len(p.history) - 1; i >= 0; i-- {
+		res = append(res, p.history[i])
+	}
+	return res
+}
+
+func (p *Project) addHistory(start time.Time, cycle string, modify, changed []string, err error) {
+	transfer := Transfer{
+		Time:     start,
+		Cycle:    cycle,
+		Duration: int64(time.Since(start) / time.Millisecond),
+		Dirs:     p.relative(modify),
+		Paths:    p.relative(changed),
+	}
+	if err != nil {
+		transfer.Error = err.Error()
+	}
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+	if len(p.history) >= historySize {
+		p.history = append(p.history[:0], p.history[1:]...)
+	}
+	p.history = append(p.history, transfer)
+}
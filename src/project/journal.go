@@ -0,0 +1,150 @@
+package project
+
+import (
+	"conf"
+	"errors"
+	"journal"
+	"os"
+	"sftp"
+	"time"
+	"util"
+)
+
+const journalSuffix = ".journal" //默认的传输日志文件为状态文件加后缀
+
+var ErrJournalDisabled = errors.New("journal disabled")
+
+//打开项目的传输日志，journal_file为off时不记录
+func (p *Project) openJournal(conf *conf.ProjectConfig) error {
+	file := conf.JournalFile
+	if file == "off" {
+		return nil
+	}
+	if len(file) == 0 {
+		file = conf.SaveProject + journalSuffix
+	}
+	j, err := journal.Open(file, int64(conf.JournalMaxSize)*1024*1024, conf.JournalMaxFiles)
+	if err != nil {
+		return err
+	}
+	p.journal = j
+	return nil
+}
+
+//查询传输日志，最新的在前
+func (p *Project) Journal(filter journal.Filter) ([]journal.Record, error) {
+	if p.journal == nil {
+		return nil, ErrJournalDisabled
+	}
+	return p.journal.Query(filter)
+}
+
+//同步轮次的标识，以开始时间表示
+func newCycle(start time.Time) string {
+	return start.Format("20060102T150405.000")
+}
+
+//将远程操作记录到传输日志的客户端，与上传一样在dirLock保护下使用
+type journalClient struct {
+	sftp.Sftp
+	project *Project
+	cycle   string
+	locals  map[string]string //远程路径到本地相对路径，首次记录非上传操作时建立
+}
+
+func newJournalClient(p *Project, cycle string, client sftp.Sftp) sftp.Sftp {
+	if p.journal == nil {
+		return client
+	}
+	return &journalClient{
+		Sftp:    client,
+		project: p,
+		cycle:   cycle,
+	}
+}
+
+//删除、创建目录等操作只有远程路径，通过目录树反查本地路径，找不到时使用远程路径
+func (c *journalClient) local(remote string) string {
+	if c.locals == nil {
+		p := c.project
+		c.locals = make(map[string]string)
+		for name, d := range p.Dirs.DirMap {
+			if rel, ok := p.mapper.Relative(name); ok {
+				c.locals[p.mapper.Remote(name)] = rel
+			}
+			for _, file := range d.File {
+				if rel, ok := p.mapper.Relative(file.Name); ok {
+					c.locals[p.mapper.Remote(file.Name)] = rel
+				}
+			}
+		}
+	}
+	if rel, ok := c.locals[remote]; ok {
+		return rel
+	}
+	return remote
+}
+
+func (c *journalClient) record(r journal.Record, start time.Time, err error) {
+	r.Time, r.Cycle = start, c.cycle
+	r.Duration = int64(time.Since(start) / time.Millisecond)
+	r.Result = journal.ResultOk
+	if err != nil {
+		r.Result, r.Error = journal.ResultError, err.Error()
+	}
+	if e := c.project.journal.Append(r); e != nil {
+		util.Error("write journal failed", util.F("project", c.project.ProjectName), util.F("op", r.Op), util.F("path", r.Path), util.F("error", e))
+	}
+}
+
+func (c *journalClient) Put(local, remote string) error {
+	start := time.Now()
+	var size int64
+	if info, err := os.Stat(local); err == nil {
+		size = info.Size()
+	}
+	err := c.Sftp.Put(local, remote)
+	if sent := c.LastSent(); sent >= 0 {
+		size = sent
+	}
+	rel, ok := c.project.mapper.Relative(local)
+	if !ok {
+		rel = remote
+	}
+	c.record(journal.Record{Op: journal.OpPut, Path: rel, Remote: remote, Size: size}, start, err)
+	return err
+}
+
+//上传的文件转换后实际发送的字节数，由进度回调记录
+func (c *journalClient) LastSent() int64 {
+	return c.project.sent
+}
+
+func (c *journalClient) Mkdir(remote string) error {
+	start := time.Now()
+	err := c.Sftp.Mkdir(remote)
+	c.record(journal.Record{Op: journal.OpMkdir, Path: c.local(remote), Remote: remote}, start, err)
+	return err
+}
+
+func (c *journalClient) Remove(remote string) error {
+	start := time.Now()
+	err := c.Sftp.Remove(remote)
+	c.record(journal.Record{Op: journal.OpRemove, Path: c.local(remote), Remote: remote}, start, err)
+	return err
+}
+
+func (c *journalClient) RemoveDirectory(remote string) error {
+	start := time.Now()
+	err := c.Sftp.RemoveDirectory(remote)
+	c.record(journal.Record{Op: journal.OpRmdir, Path: c.local(remote), Remote: remote}, start, err)
+	return err
+}
+
+//重命名记录新路径，原路径记录在from
+func (c *journalClient) Rename(oldRemote, newRemote string) error {
+	start := time.Now()
+	err := c.Sftp.Rename(oldRemote, newRemote)
+	c.record(journal.Record{Op: journal.OpRename, Path: c.local(newRemote), Remote: newRemote, From: oldRemote}, start, err)
+	return err
+}
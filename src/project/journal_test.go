@@ -0,0 +1,142 @@
+package project
+
+import (
+	"bytes"
+	"conf"
+	"io/ioutil"
+	"journal"
+	"metrics"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProject_Journal(t *testing.T) {
+	p, local, _ := newTestProject(t)
+	records, err := p.Journal(journal.Filter{Op: journal.OpPut})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0, len(records))
+	for _, r := range records {
+		if r.Result != journal.ResultOk || len(r.Cycle) == 0 {
+			t.Errorf("unexpected record %+v", r)
+		}
+		paths = append(paths, r.Path)
+	}
+	sort.Strings(paths)
+	if len(paths) != 3 || paths[0] != "css/a.css" || paths[1] != "index.html" || paths[2] != "js/lib/b.js" {
+		t.Errorf("full upload journal %v", paths)
+	}
+	if records, _ := p.Journal(journal.Filter{Op: journal.OpMkdir, Path: "js"}); len(records) != 2 {
+		t.Errorf("mkdir of js expect 2 records, got %+v", records)
+	}
+
+	ioutil.WriteFile(filepath.Join(local, "css", "b.css"), []byte("p{}"), 0666)
+	os.Remove(filepath.Join(local, "index.html"))
+	p.check() //新文件再经过一轮没有变化的检测才上传
+	modify, err := p.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.sftp(modify); err != nil {
+		t.Fatal(err)
+	}
+	cycle := p.History()[0].Cycle
+	records, err = p.Journal(journal.Filter{Cycle: cycle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := make(map[string]string)
+	for _, r := range records {
+		ops[r.Path] = r.Op
+	}
+	if len(ops) != 2 || ops["css/b.css"] != journal.OpPut || ops["index.html"] != journal.OpRemove {
+		t.Errorf("journal of cycle %s: %v", cycle, ops)
+	}
+}
+
+//模拟sftp客户端的进度回调
+type progressClient struct {
+	dirClient
+	project *Project
+}
+
+func (c *progressClient) Put(local, remote string) error {
+	err := c.dirClient.Put(local, remote)
+	if info, e := os.Stat(local); e == nil {
+		c.project.progress(local, info.Size(), info.Size())
+	}
+	return err
+}
+
+//转换后上传时记录实际发送的字节数
+func TestProject_JournalSentBytes(t *testing.T) {
+	p, local, remote := newTestProject(t)
+	p.client = &progressClient{dirClient: dirClient{root: remote}, project: p}
+	p.transforms = []*conf.TransformConfig{{Pattern: "*.html", Type: "gzip", Suffix: ".gz"}}
+	ioutil.WriteFile(filepath.Join(local, "index.html"), bytes.Repeat([]byte("<p>hello</p>"), 1000), 0666)
+	p.check()
+	modify, err := p.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.sftp(modify); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(remote, "index.html.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, _ := p.Journal(journal.Filter{Cycle: p.History()[0].Cycle, Op: journal.OpPut})
+	if len(records) != 1 || records[0].Size != info.Size() {
+		t.Errorf("journal %+v, expect size %d", records, info.Size())
+	}
+}
+
+//未启用传输日志时上传字节数同样按实际发送的字节数统计
+func TestProject_SentBytesWithoutJournal(t *testing.T) {
+	p, local, remote := newTestProject(t)
+	j := p.journal
+	p.journal = nil
+	t.Cleanup(func() { p.journal = j })
+	p.client = &progressClient{dirClient: dirClient{root: remote}, project: p}
+	p.transforms = []*conf.TransformConfig{{Pattern: "*.html", Type: "gzip", Suffix: ".gz"}}
+	ioutil.WriteFile(filepath.Join(local, "index.html"), bytes.Repeat([]byte("<p>hello</p>"), 1000), 0666)
+	p.check()
+	modify, err := p.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := uploadedBytes(t, p.ProjectName)
+	if err := p.sftp(modify); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(remote, "index.html.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := uploadedBytes(t, p.ProjectName) - before; n != info.Size() {
+		t.Errorf("uploaded bytes %d, expect %d", n, info.Size())
+	}
+}
+
+//从指标输出中读取项目的上传字节数
+func uploadedBytes(t *testing.T, name string) int64 {
+	buf := new(bytes.Buffer)
+	metrics.WriteText(buf)
+	prefix := `autosftp_uploaded_bytes_total{project="` + name + `"} `
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			n, err := strconv.ParseFloat(strings.TrimPrefix(line, prefix), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return int64(n)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,153 @@
+package project
+
+import (
+	"conf"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"util"
+)
+
+//重新加载配置的结果，均为项目名称
+type ReloadResult struct {
+	Started   []string `json:"started"`
+	Stopped   []string `json:"stopped"`
+	Restarted []string `json:"restarted"`
+	Failed    []string `json:"failed"`  //启动失败，由Retry定时重试
+}
+
+//按配置启动、停止项目，重新加载配置时只重启配置变化的项目
+type Manager struct {
+	lock     sync.Mutex
+	projects *Projects
+	configs  map[string]*conf.ProjectConfig //运行中项目的配置
+	failed   map[string]*conf.ProjectConfig //启动失败项目的配置
+	closing  int32                          //开始停止后不再启动项目，原子更新
+	open     func(conf *conf.ProjectConfig) (*Project, error)
+}
+
+func NewManager(projects *Projects) *Manager {
+	return &Manager{
+		projects: projects,
+		configs:  make(map[string]*conf.ProjectConfig),
+		failed:   make(map[string]*conf.ProjectConfig),
+		open:     Open,
+	}
+}
+
+//比较新配置与运行中的项目：启动新开启的项目，停止关闭或删除的项目，重启配置变化的项目
+//先停止再启动，重启的项目释放状态文件后才重新打开
+func (m *Manager) Apply(config *conf.Config) ReloadResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var res ReloadResult
+	if m.isClosing() {
+		return res
+	}
+	SetGlobalBandwidth(config.BandwidthLimit)
+	enabled := make(map[string]*conf.ProjectConfig)
+	for _, c := range config.Conf {
+		if c.Switch != "on" {
+			continue
+		}
+		if _, ok := enabled[c.Name]; ok {
+			util.Error("duplicate project name, ignored", util.F("project", c.Name))
+			continue
+		}
+		enabled[c.Name] = c
+	}
+	restart := make(map[string]bool)
+	for _, name := range sortedNames(m.configs) {
+		c, ok := enabled[name]
+		if ok && reflect.DeepEqual(c, m.configs[name]) {
+			continue
+		}
+		m.stop(name)
+		if ok {
+			restart[name] = true
+		}else{
+			res.Stopped = append(res.Stopped, name)
+		}
+	}
+	m.failed = make(map[string]*conf.ProjectConfig)
+	for _, name := range sortedNames(enabled) {
+		if _, ok := m.configs[name]; ok {
+			continue
+		}
+		if m.isClosing() {
+			break
+		}
+		if err := m.start(enabled[name]); err != nil {
+			util.Error("project start failed", util.F("project", name), util.F("error", err))
+			m.failed[name] = enabled[name]
+			res.Failed = append(res.Failed, name)
+		}else if restart[name] {
+			res.Restarted = append(res.Restarted, name)
+		}else{
+			res.Started = append(res.Started, name)
+		}
+	}
+	return res
+}
+
+//重新启动上次启动失败的项目，仍然失败的项目等待下一次重试
+func (m *Manager) Retry() ReloadResult {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var res ReloadResult
+	for _, name := range sortedNames(m.failed) {
+		if m.isClosing() {
+			break
+		}
+		if err := m.start(m.failed[name]); err != nil {
+			util.Error("project retry failed", util.F("project", name), util.F("error", err))
+			res.Failed = append(res.Failed, name)
+		}else{
+			delete(m.failed, name)
+			res.Started = append(res.Started, name)
+		}
+	}
+	return res
+}
+
+func (m *Manager) start(c *conf.ProjectConfig) error {
+	p, err := m.open(c)
+	if err != nil {
+		return err
+	}
+	m.configs[c.Name] = c
+	m.projects.Set(p)
+	return nil
+}
+
+//先从项目列表中删除，web服务不再访问后关闭
+func (m *Manager) stop(name string) {
+	delete(m.configs, name)
+	if p, ok := m.projects.Delete(name); ok {
+		p.Close()
+	}
+}
+
+//停止所有项目，正在执行的Apply、Retry不再启动剩余的项目，之后的调用直接返回
+func (m *Manager) Close() {
+	atomic.StoreInt32(&m.closing, 1)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, name := range sortedNames(m.configs) {
+		m.stop(name)
+	}
+}
+
+func (m *Manager) isClosing() bool {
+	return atomic.LoadInt32(&m.closing) != 0
+}
+
+func sortedNames(configs map[string]*conf.ProjectConfig) []string {
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,107 @@
+package project
+
+import (
+	"conf"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestManager_Apply(t *testing.T) {
+	projects := NewProjects()
+	m := NewManager(projects)
+	opened := make([]string, 0)
+	m.open = func(c *conf.ProjectConfig) (*Project, error) {
+		if c.RemoteAddress == "unreachable" {
+			return nil, errors.New("dial failed")
+		}
+		opened = append(opened, c.Name)
+		p := newProject(c)
+		p.client = &dirClient{root: t.TempDir()}
+		return p, nil
+	}
+	defer m.Close()
+	config := &conf.Config{Conf: []*conf.ProjectConfig{
+		{Switch: "on", Name: "a", User: "u", LocalOs: "linux", RemoteOs: "linux"},
+		{Switch: "on", Name: "b", User: "u", LocalOs: "linux", RemoteOs: "linux"},
+		{Switch: "off", Name: "c", User: "u", LocalOs: "linux", RemoteOs: "linux"},
+	}}
+	res := m.Apply(config)
+	if !reflect.DeepEqual(res.Started, []string{"a", "b"}) || len(projects.List()) != 2 {
+		t.Fatalf("first apply %+v", res)
+	}
+	a, _ := projects.Get("a")
+
+	//b修改了密码，c开启，a不变
+	config = &conf.Config{Conf: []*conf.ProjectConfig{
+		{Switch: "on", Name: "a", User: "u", LocalOs: "linux", RemoteOs: "linux"},
+		{Switch: "on", Name: "b", User: "u", LocalOs: "linux", RemoteOs: "linux", Passwd: "new"},
+		{Switch: "on", Name: "c", User: "u", LocalOs: "linux", RemoteOs: "linux"},
+	}}
+	res = m.Apply(config)
+	if !reflect.DeepEqual(res.Started, []string{"c"}) || !reflect.DeepEqual(res.Restarted, []string{"b"}) || len(res.Stopped) != 0 {
+		t.Errorf("second apply %+v", res)
+	}
+	if p, _ := projects.Get("a"); p != a {
+		t.Errorf("unchanged project should keep running")
+	}
+	if b, _ := projects.Get("b"); b.Passwd != "new" {
+		t.Errorf("restarted project should use new config")
+	}
+
+	//a关闭，c无法连接，b删除
+	config = &conf.Config{Conf: []*conf.ProjectConfig{
+		{Switch: "off", Name: "a", User: "u", LocalOs: "linux", RemoteOs: "linux"},
+		{Switch: "on", Name: "c", User: "u", LocalOs: "linux", RemoteOs: "linux", RemoteAddress: "unreachable"},
+	}}
+	res = m.Apply(config)
+	if !reflect.DeepEqual(res.Stopped, []string{"a", "b"}) || !reflect.DeepEqual(res.Failed, []string{"c"}) {
+		t.Errorf("third apply %+v", res)
+	}
+	if len(projects.List()) != 0 {
+		t.Errorf("projects left %v", projects.List())
+	}
+	if a.Status().State != StateStopped {
+		t.Errorf("stopped project state %s", a.Status().State)
+	}
+	if !reflect.DeepEqual(opened, []string{"a", "b", "b", "c"}) {
+		t.Errorf("opened %v", opened)
+	}
+}
+
+func TestManager_Retry(t *testing.T) {
+	projects := NewProjects()
+	m := NewManager(projects)
+	reachable := false
+	m.open = func(c *conf.ProjectConfig) (*Project, error) {
+		if !reachable {
+			return nil, errors.New("dial failed")
+		}
+		p := newProject(c)
+		p.client = &dirClient{root: t.TempDir()}
+		return p, nil
+	}
+	config := &conf.Config{Conf: []*conf.ProjectConfig{
+		{Switch: "on", Name: "a", User: "u", LocalOs: "linux", RemoteOs: "linux"},
+	}}
+	if res := m.Apply(config); !reflect.DeepEqual(res.Failed, []string{"a"}) {
+		t.Fatalf("apply %+v", res)
+	}
+	if res := m.Retry(); !reflect.DeepEqual(res.Failed, []string{"a"}) || len(projects.List()) != 0 {
+		t.Errorf("retry while unreachable %+v", res)
+	}
+	reachable = true
+	if res := m.Retry(); !reflect.DeepEqual(res.Started, []string{"a"}) || len(projects.List()) != 1 {
+		t.Errorf("retry %+v", res)
+	}
+	if res := m.Retry(); len(res.Started) != 0 || len(res.Failed) != 0 {
+		t.Errorf("nothing to retry %+v", res)
+	}
+
+	//停止后不再启动项目
+	m.Close()
+	config.Conf = append(config.Conf, &conf.ProjectConfig{Switch: "on", Name: "b", User: "u", LocalOs: "linux", RemoteOs: "linux"})
+	if res := m.Apply(config); len(res.Started) != 0 || len(projects.List()) != 0 {
+		t.Errorf("apply after close %+v", res)
+	}
+}
@@ -0,0 +1,42 @@
+package project
+
+import (
+	"metrics"
+	"time"
+)
+
+var (
+	uploadDuration = metrics.NewHistogramVec("autosftp_upload_duration_seconds", "Latency of uploading a single file.", nil, "project")
+	syncDuration = metrics.NewHistogramVec("autosftp_sync_duration_seconds", "Duration of a sync round including hooks.", nil, "project")
+	syncFailures = metrics.NewCounterVec("autosftp_sync_failures_total", "Number of failed sync rounds.", "project")
+	reconnects = metrics.NewCounterVec("autosftp_reconnects_total", "Number of reconnections to the remote server.", "project")
+	pendingDirs = metrics.NewGaugeVec("autosftp_pending_dirs", "Number of changed directories waiting to be uploaded.", "project")
+	lastSyncTime = metrics.NewGaugeVec("autosftp_last_sync_timestamp_seconds", "Unix time of the last successful sync, 0 if none since start.", "project")
+	sinceLastSync = metrics.NewGaugeVec("autosftp_seconds_since_last_sync", "Seconds since the last successful sync, or since start if none.", "project")
+)
+
+func (p *Project) initMetrics() {
+	started := time.Now()
+	syncFailures.Add(0, p.ProjectName)
+	reconnects.Add(0, p.ProjectName)
+	pendingDirs.Set(0, p.ProjectName)
+	lastSyncTime.Set(0, p.ProjectName)
+	sinceLastSync.SetFunc(func() float64 {
+		last := p.Status().LastSync
+		if last.IsZero() {
+			last = started
+		}
+		return time.Since(last).Seconds()
+	}, p.ProjectName)
+}
+
+func (p *Project) deleteMetrics() {
+	uploadDuration.Delete(p.ProjectName)
+	syncDuration.Delete(p.ProjectName)
+	syncFailures.Delete(p.ProjectName)
+	reconnects.Delete(p.ProjectName)
+	pendingDirs.Delete(p.ProjectName)
+	lastSyncTime.Delete(p.ProjectName)
+	sinceLastSync.Delete(p.ProjectName)
+	p.Dirs.DeleteMetrics()
+}
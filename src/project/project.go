@@ -4,11 +4,16 @@ import (
 	"conf"
 	"context"
 	"dir"
+	"event"
 	"fmt"
+	"hook"
 	"io"
+	"journal"
+	"mapping"
 	"os"
 	"path/filepath"
 	"sftp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -17,18 +22,29 @@ import (
 
 const (
 	sftpTimeout = 5 * time.Second
+	defaultCheckInterval = 2 * time.Second
+	defaultMaxCheckInterval = time.Minute
+	defaultSaveInterval = 30 * time.Minute
+)
+
+//检测模式
+const (
+	ModeAuto = "auto"                  //定时检测，检测到变更自动上传
+	ModeManual = "manual"              //定时检测，变更排队到手动触发时上传
+	ModeAdaptive = "adaptive"          //同auto，持续没有变更时逐步延长检测间隔
 )
 
 type Project struct {
 	ProjectName string
 	User string
-	Passwd string
+	Passwd conf.Secret
 	LocalBaseDir string
 	LocalSeparator string
 	RemoteAddress string
 	RemoteBaseDir string
 	RemoteSeparator string
 	SaveProject string
+	SaveFormat string
 	Dirs *dir.Directory
 
 	localSeparator string
@@ -36,6 +52,28 @@ type Project struct {
 	dirFp *os.File
 	fp *os.File
 	client sftp.Sftp
+	mapper *mapping.Mapper
+	preHook *hook.Local
+	remoteHook *hook.Remote
+	transforms []*conf.TransformConfig
+	limiter *sftp.Limiter
+	schedule *schedule
+	quietPeriod time.Duration
+	maxBatchDelay time.Duration
+	mode string
+	checkInterval time.Duration
+	maxCheckInterval time.Duration
+	saveInterval time.Duration
+	trigger chan struct{}
+	retry chan struct{}
+	status Status
+	history []Transfer
+	journal *journal.Journal       //传输日志，为nil时不记录
+	uploading string               //正在上传的文件（相对路径），用于进度事件
+	lastProgress time.Time
+	sent int64                     //正在上传的文件已发送的字节数，由进度回调更新，-1表示客户端没有报告进度
+	statusLock sync.RWMutex
+	dirLock sync.RWMutex           //保护Dirs，检测和上传时加写锁
 	ctx context.Context
 	cancel context.CancelFunc
 	group sync.WaitGroup
@@ -50,80 +88,140 @@ func newProject(conf *conf.ProjectConfig) *Project {
 		RemoteAddress:conf.RemoteAddress,
 		RemoteBaseDir:conf.RemoteBaseDir,
 		SaveProject:conf.SaveProject,
+		SaveFormat:conf.SaveFormat,
 		localSeparator:separator(conf.LocalOs),
 		remoteSeparator:separator(conf.RemoteOs),
 		dirFp:nil,
 		fp:nil,
 		Dirs:dir.New(),
+		preHook:hook.NewLocal(conf.Name, conf.LocalBaseDir, conf.PreHooks),
+		remoteHook:hook.NewRemote(conf.Name, conf.RemoteHooks),
+		transforms:conf.Transforms,
+		limiter:sftp.NewLimiter(int64(conf.BandwidthLimit) * 1024),
+		quietPeriod:time.Duration(conf.QuietPeriod) * time.Millisecond,
+		maxBatchDelay:time.Duration(conf.MaxBatchDelay) * time.Millisecond,
+		mode:conf.Mode,
+		checkInterval:time.Duration(conf.CheckInterval) * time.Millisecond,
+		maxCheckInterval:time.Duration(conf.MaxCheckInterval) * time.Millisecond,
+		saveInterval:time.Duration(conf.SaveInterval) * time.Second,
+		trigger:make(chan struct{}, 1),
+		retry:make(chan struct{}, 1),
 		group:sync.WaitGroup{},
 	}
+	project.Dirs.SetScanWorkers(conf.ScanWorkers)
+	project.Dirs.SetName(conf.Name)
+	project.Dirs.SetWriteCheck(true)
+	if project.mode == "" {
+		project.mode = ModeAuto
+	}
+	if project.checkInterval <= 0 {
+		project.checkInterval = defaultCheckInterval
+	}
+	if project.maxCheckInterval < project.checkInterval {
+		project.maxCheckInterval = defaultMaxCheckInterval
+		if project.maxCheckInterval < project.checkInterval {
+			project.maxCheckInterval = project.checkInterval
+		}
+	}
+	if project.saveInterval <= 0 {
+		project.saveInterval = defaultSaveInterval
+	}
+	project.status = Status{
+		Name:conf.Name,
+		State:StateRunning,
+		Mode:project.mode,
+		LocalBaseDir:conf.LocalBaseDir,
+		RemoteAddress:conf.RemoteAddress,
+		RemoteBaseDir:conf.RemoteBaseDir,
+	}
+	project.initMetrics()
 	project.ctx, project.cancel = context.WithCancel(context.Background())
 	return project
 }
 
-func Open(conf *conf.ProjectConfig) (*Project, error) {
+func Open(conf *conf.ProjectConfig) (_ *Project, err error) {
 	p := newProject(conf)
+	defer func(){
+		if err != nil { //newProject已经注册了指标，失败时与已打开的资源一起释放
+			p.release()
+		}
+	}()
 	if !filepath.IsAbs(p.LocalBaseDir) {
 		return nil, fmt.Errorf("%s is not absolute path", p.LocalBaseDir)
 	}
+	mapper, err := mapping.New(conf, p.localSeparator, p.remoteSeparator)
+	if err != nil {
+		return nil, err
+	}
+	p.mapper = mapper
+	if p.schedule, err = newSchedule(conf); err != nil {
+		return nil, err
+	}
+	if err = p.openJournal(conf); err != nil {
+		return nil, err
+	}
 	//锁住当前基目录，防止被手动删除
-	if dirFp, err := os.OpenFile(p.LocalBaseDir, os.O_RDONLY, os.ModeDir); err != nil {
+	if p.dirFp, err = os.OpenFile(p.LocalBaseDir, os.O_RDONLY, os.ModeDir); err != nil {
 		return nil, err
-	}else{
-		p.dirFp = dirFp
 	}
-	cli,err := sftp.Dial(p.RemoteAddress, p.User, p.Passwd, sftpTimeout)
-	if err != nil{
-		return  nil, err
+	if p.client, err = dialSftp(p); err != nil {
+		return nil, err
 	}
-	p.client = cli
 	p.fp, err = os.OpenFile(p.SaveProject, os.O_RDWR, 0666)
 	if err != nil {
 		if os.IsNotExist(err) {
 			if p.fp, err = os.Create(p.SaveProject); err != nil {
 				return nil, err
 			}
-			defer func(){
-				if err != nil {
-					p.fp.Close()
-				}
-			}()
 			if err = p.Dirs.Open(p.LocalBaseDir); err != nil { //遍历
 				return nil, err
 			}
-			if err = p.sftp([]string{p.LocalBaseDir}); err != nil {          //上传
-				return nil,  err
-			}
-			if err := p.write(); err != nil {    //保存
+			//遍历后所有目录为Add状态，由run按暂停、传输窗口和限速上传，未上传前保存的状态重启后仍会上传
+			if err = p.write(); err != nil {    //保存
 				return nil, err
 			}
 		}else {
 			return nil, err
 		}
 	}else{
-		if err := p.read(); err != nil {
-			p.fp.Close()
+		if err = p.read(); err != nil {
 			return nil, err
 		}
 	}
-	go p.run()
+	p.run()
 	return p, nil
 }
 func (p *Project) Close(){
+	p.setState(StateStopped)
 	p.cancel()
 	p.group.Wait()
 	p.write()
-	p.dirFp.Close()
-	p.fp.Close()
-	p.client.Close()
+	p.release()
 }
 
+//关闭Open中打开的文件、连接和日志，删除项目的指标
+func (p *Project) release() {
+	p.cancel()
+	if p.dirFp != nil {
+		p.dirFp.Close()
+	}
+	if p.fp != nil {
+		p.fp.Close()
+	}
+	if p.client != nil {
+		p.client.Close()
+	}
+	if p.journal != nil {
+		p.journal.Close()
+	}
+	p.deleteMetrics()
+}
 
 func (p *Project) run(){
 	run := func(){
-		p.group.Add(1)
-		checkTimer := time.NewTicker(2 * time.Second)
-		saveTimer := time.NewTicker(30 * time.Minute)
+		checkInterval := p.checkInterval
+		checkTimer := time.NewTimer(checkInterval)
+		saveTimer := time.NewTicker(p.saveInterval)
 		modifyCh := make(chan []string)
 		defer func(){
 			checkTimer.Stop()
@@ -132,51 +230,139 @@ func (p *Project) run(){
 			p.group.Done()
 		}()
 		var e error
+		var pendingSince time.Time //当前批次中最早检测到变更的时间
+		var reported string        //当前批次已记录日志的变更目录，等待上传期间目录不变时不重复记录
+		send := func(res []string) {
+			pendingSince = time.Time{}
+			reported = ""
+			go func(){
+				defer func(){
+					recover()
+				}()
+				modifyCh <- res
+			}()
+		}
 		for {
 			e = nil
-			util.LogPrint("project", util.I, "Run",p.ProjectName,"watch")
+			util.Debug("watch", util.F("project", p.ProjectName))
 			select {
 			case <-p.ctx.Done():
-				util.LogPrint("project", util.I, "Run",p.ProjectName,"watch finish")
+				util.Info("watch finish", util.F("project", p.ProjectName))
 				return
 			case <-checkTimer.C:
-				if res, err := p.Dirs.CheckModify(); err != nil {
-					e = fmt.Errorf("check failed:", err)
+				res, err := p.check()
+				checkInterval = p.nextInterval(checkInterval, err == nil && len(res) == 0)
+				checkTimer.Reset(checkInterval)
+				if err != nil {
+					e = fmt.Errorf("check failed:%v", err)
 				}else{
 					if len(res) >0 {
-						util.LogPrint("project", util.I, "Run",p.ProjectName, fmt.Sprint("modify:", res))
-						go func(){
-							defer func(){
-								recover()
-							}()
-							modifyCh <- res
-						}()
+						if key := batchKey(res); key != reported {
+							reported = key
+							util.Info("modify detected", util.F("project", p.ProjectName), util.F("dirs", p.relative(res)))
+						}else{
+							util.Debug("modify pending", util.F("project", p.ProjectName), util.F("dirs", p.relative(res)))
+						}
+						if p.mode == ModeManual || p.paused() {
+							util.Debug("manual mode or paused, upload queued until triggered", util.F("project", p.ProjectName))
+							continue
+						}
+						now := time.Now()
+						if pendingSince.IsZero() {
+							pendingSince = now
+						}
+						if !p.stable(res, pendingSince, now) {
+							util.Debug("waiting for changes to settle", util.F("project", p.ProjectName))
+							continue
+						}
+						//传输窗口外只检测变更，未上传的目录状态保持不变，下一轮检测时会再次返回
+						allow, rate := p.schedule.current(now)
+						if !allow {
+							util.Debug("outside transfer window, upload queued", util.F("project", p.ProjectName))
+							continue
+						}
+						p.limiter.SetRate(rate)
+						send(res)
 					}
 				}
+			case <-p.trigger:
+				//手动触发时立即检测并上传，不等待静默期和传输窗口
+				util.Info("sync triggered", util.F("project", p.ProjectName))
+				checkInterval = p.checkInterval
+				checkTimer.Reset(checkInterval)
+				if res, err := p.check(); err != nil {
+					e = fmt.Errorf("check failed:%v", err)
+				}else if len(res) > 0 {
+					_, rate := p.schedule.current(time.Now())
+					p.limiter.SetRate(rate)
+					send(res)
+				}
+			case <-p.retry:
+				//只重新上传最近一次同步失败的目录，不检测新的变更，不等待静默期和传输窗口
+				if res := p.failedDirs(); len(res) > 0 {
+					util.Info("retry failed dirs", util.F("project", p.ProjectName), util.F("dirs", p.relative(res)))
+					_, rate := p.schedule.current(time.Now())
+					p.limiter.SetRate(rate)
+					send(res)
+				}
 			case <-saveTimer.C:
 				if err := p.write(); err != nil {
-					e = fmt.Errorf("save failed:", err)
+					e = fmt.Errorf("save failed:%v", err)
 				}
 			case res, ok := <-modifyCh:
 				if ok {
-					if err := p.sftp(res); err != nil {
-						e = fmt.Errorf("upload failed:", err)
+					err := p.sftp(res)
+					if err != nil {
+						e = fmt.Errorf("upload failed:%v", err)
+					}else{
+						util.Info("upload finish", util.F("project", p.ProjectName), util.F("dirs", p.relative(res)))
 					}
-					util.LogPrint("project", util.I, "Run",p.ProjectName, fmt.Sprint("upload finish:", res))
+					p.setSync(res, err)
 				}
 			}
 			if e != nil {
-				util.LogPrint("project", util.I, "Run",p.ProjectName,fmt.Sprint("watch failed:", e))
+				p.setError(e)
+				util.Error("watch failed", util.F("project", p.ProjectName), util.F("error", e))
 			}
 		}
 	}
+	p.group.Add(1)
 	go run()
 }
 
+//变更目录排序后拼接，并发扫描时返回的顺序不固定
+func batchKey(dirs []string) string {
+	sorted := append([]string(nil), dirs...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, "\n")
+}
+
+//触发一次立即检测和上传，manual模式下只有触发时才上传
+func (p *Project) Sync() {
+	select {
+	case p.trigger <- struct{}{}:
+	default: //已有未处理的触发
+	}
+}
+
+//adaptive模式下连续没有变更时检测间隔逐步翻倍，直到max_check_interval，检测到变更后恢复
+func (p *Project) nextInterval(current time.Duration, idle bool) time.Duration {
+	if p.mode != ModeAdaptive || !idle {
+		return p.checkInterval
+	}
+	next := current * 2
+	if next > p.maxCheckInterval {
+		next = p.maxCheckInterval
+	}
+	return next
+}
+
 func (p *Project) write() error {
+	p.dirLock.RLock()
+	defer p.dirLock.RUnlock()
 	p.fp.Truncate(0)
 	p.fp.Seek(0, io.SeekStart)
-	if err := p.Dirs.EncodeJson(p.fp); err != nil {
+	if err := p.Dirs.Encode(p.fp, p.ProjectName, p.SaveFormat); err != nil {
 		return err
 	}
 	if err := p.fp.Sync(); err != nil {
@@ -185,24 +371,89 @@ func (p *Project) write() error {
 	return nil
 }
 func (p *Project) read() error {
-	return p.Dirs.DecodeJson(p.fp)
+	version, err := p.Dirs.Decode(p.fp, p.ProjectName, p.LocalBaseDir)
+	if err != nil {
+		return err
+	}
+	//旧版本的状态文件加载后立即按当前格式保存
+	if version < dir.StateVersion {
+		util.Info("migrate state file", util.F("project", p.ProjectName), util.F("from", version), util.F("to", dir.StateVersion))
+		return p.write()
+	}
+	return nil
 }
 
-func (p *Project) sftp( modify []string) error {
-	err := p.Dirs.Upload(p.client, p.LocalBaseDir, p.RemoteBaseDir, p.localSeparator, p.remoteSeparator, modify)
-	for i:=1; i>=0; i-- {
-		if err == nil {
-			return err
+func (p *Project) sftp( modify []string) (err error) {
+	var changed []string
+	start := time.Now()
+	cycle := newCycle(start)
+	defer func(){
+		syncDuration.Observe(time.Since(start).Seconds(), p.ProjectName)
+		if err != nil {
+			syncFailures.Inc(p.ProjectName)
 		}
-		cli,err := sftp.Dial(p.RemoteAddress, p.User, p.Passwd, sftpTimeout)
-		if err != nil{
-			return  err
+		p.addHistory(start, cycle, modify, changed, err)
+	}()
+	//本地钩子执行失败时中止本轮同步，变更保留到下一轮
+	if err = p.preHook.Run(modify, p.relative(modify)); err != nil {
+		return err
+	}
+	p.dirLock.Lock()
+	changed, err = p.Dirs.Upload(newJournalClient(p, cycle, newEventClient(p, hook.NewTransform(p.client, p.transforms))), p.mapper, modify)
+	for i:=1; i>=0 && err != nil; i-- {
+		p.publish(event.ConnectionLost, event.Event{Error: err.Error()})
+		cli,e := dialSftp(p)
+		if e != nil{
+			p.dirLock.Unlock()
+			return  e
 		}
+		p.publish(event.ConnectionRestored, event.Event{})
+		reconnects.Inc(p.ProjectName)
 		p.client.Close()
 		p.client = cli
-		err = p.Dirs.Upload(p.client, p.LocalBaseDir, p.RemoteBaseDir, p.localSeparator, p.remoteSeparator, modify)
+		var retry []string
+		retry, err = p.Dirs.Upload(newJournalClient(p, cycle, newEventClient(p, hook.NewTransform(p.client, p.transforms))), p.mapper, modify)
+		changed = append(changed, retry...)
+	}
+	p.dirLock.Unlock()
+	if err != nil {
+		return err
+	}
+	//同步成功后执行远程钩子
+	return p.remoteHook.Run(p.client, p.relative(changed))
+}
+
+//变更在静默期内没有再发生变化，或者等待超过最大批次延迟时才上传
+func (p *Project) stable(modify []string, pendingSince, now time.Time) bool {
+	if p.quietPeriod <= 0 {
+		return true
+	}
+	if now.Sub(p.Dirs.LastChange(modify)) >= p.quietPeriod {
+		return true
+	}
+	if p.maxBatchDelay > 0 && now.Sub(pendingSince) >= p.maxBatchDelay {
+		util.Info("max batch delay reached, upload unsettled changes", util.F("project", p.ProjectName))
+		return true
+	}
+	return false
+}
+
+//建立sftp连接，测试时替换
+var dialSftp = (*Project).dial
+
+func (p *Project) dial() (sftp.Sftp, error) {
+	return sftp.Dial(p.RemoteAddress, p.User, string(p.Passwd), sftpTimeout, sftp.WithLimiter(globalLimiter, p.limiter), sftp.WithProgress(p.progress))
+}
+
+//将本地绝对路径转换为相对LocalBaseDir、以/分隔的路径
+func (p *Project) relative(paths []string) []string {
+	res := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if rel, ok := p.mapper.Relative(path); ok {
+			res = append(res, rel)
+		}
 	}
-	return err
+	return res
 }
 
 
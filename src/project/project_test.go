@@ -5,6 +5,7 @@ import (
 	"conf"
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 func TestProject_Open(t *testing.T) {
@@ -37,4 +38,67 @@ func TestProject_Open(t *testing.T) {
 		t.Error(err)
 	}
 	p.Close()
-}
\ No newline at end of file
+}
+
+func TestSchedule_Current(t *testing.T) {
+	config := &conf.ProjectConfig{
+		BandwidthLimit: 100,
+		TransferWindows: []*conf.TransferWindow{
+			{Start: "09:00", End: "18:00", BandwidthLimit: 10},
+			{Start: "22:00", End: "02:00", Pause: true},
+		},
+	}
+	s, err := newSchedule(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		clock string
+		allow bool
+		rate  int64
+	}{
+		{"10:00", true, 10 * 1024},
+		{"18:00", true, 100 * 1024},
+		{"23:30", false, 100 * 1024},
+		{"01:59", false, 100 * 1024},
+	}
+	for _, c := range cases {
+		now, _ := time.Parse("15:04", c.clock)
+		if allow, rate := s.current(now); allow != c.allow || rate != c.rate {
+			t.Errorf("%s: allow=%v rate=%d, expect allow=%v rate=%d", c.clock, allow, rate, c.allow, c.rate)
+		}
+	}
+	config.TransferWindowsOnly = true
+	s, _ = newSchedule(config)
+	now, _ := time.Parse("15:04", "20:00")
+	if allow, _ := s.current(now); allow {
+		t.Error("expect upload paused outside transfer windows")
+	}
+	config.TransferWindows[0].Start = "9点"
+	if _, err := newSchedule(config); err == nil {
+		t.Error("expect invalid window error")
+	}
+}
+
+func TestProject_NextInterval(t *testing.T) {
+	config := &conf.ProjectConfig{LocalOs: "Linux", RemoteOs: "Linux", Mode: ModeAdaptive, CheckInterval: 1000, MaxCheckInterval: 5000}
+	p := newProject(config)
+	interval := p.checkInterval
+	expect := []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for _, e := range expect {
+		if interval = p.nextInterval(interval, true); interval != e {
+			t.Errorf("idle interval %v, expect %v", interval, e)
+		}
+	}
+	if interval = p.nextInterval(interval, false); interval != time.Second {
+		t.Errorf("interval after change %v, expect 1s", interval)
+	}
+
+	p = newProject(&conf.ProjectConfig{LocalOs: "Linux", RemoteOs: "Linux"})
+	if p.mode != ModeAuto || p.checkInterval != defaultCheckInterval || p.saveInterval != defaultSaveInterval {
+		t.Errorf("default mode:%s check:%v save:%v", p.mode, p.checkInterval, p.saveInterval)
+	}
+	if interval := p.nextInterval(p.checkInterval, true); interval != defaultCheckInterval {
+		t.Errorf("auto mode interval %v", interval)
+	}
+}
@@ -0,0 +1,53 @@
+package project
+
+import (
+	"sort"
+	"sync"
+)
+
+//运行中的项目，配置重新加载时增删，web服务并发访问
+type Projects struct {
+	lock     sync.RWMutex
+	projects map[string]*Project
+}
+
+func NewProjects() *Projects {
+	return &Projects{
+		projects: make(map[string]*Project),
+	}
+}
+
+func (s *Projects) Get(name string) (*Project, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	p, ok := s.projects[name]
+	return p, ok
+}
+
+//按名称排序
+func (s *Projects) List() []*Project {
+	s.lock.RLock()
+	list := make([]*Project, 0, len(s.projects))
+	for _, p := range s.projects {
+		list = append(list, p)
+	}
+	s.lock.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ProjectName < list[j].ProjectName
+	})
+	return list
+}
+
+func (s *Projects) Set(p *Project) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.projects[p.ProjectName] = p
+}
+
+func (s *Projects) Delete(name string) (*Project, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p, ok := s.projects[name]
+	delete(s.projects, name)
+	return p, ok
+}
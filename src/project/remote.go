@@ -0,0 +1,360 @@
+package project
+
+import (
+	"dir"
+	"errors"
+	"fmt"
+	"hook"
+	"os"
+	"path"
+	"path/filepath"
+	"sftp"
+	"sort"
+	"strings"
+	"time"
+)
+
+//相对路径中包含..，可能访问基目录之外的目录
+var ErrInvalidPath = errors.New("invalid path")
+
+//本地与远程的差异
+const (
+	DiffMissing  = "missing"  //本地存在，远程不存在
+	DiffExtra    = "extra"    //远程存在，本地不存在
+	DiffSize     = "size"     //大小不一致
+	DiffOutdated = "outdated" //远程修改时间早于本地，本地修改后未上传
+	DiffType     = "type"     //一方是文件，另一方是目录
+)
+
+type RemoteEntry struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"` //dir、file
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`
+	ModifyTime time.Time `json:"modify_time"`
+}
+
+type DiffEntry struct {
+	Path        string    `json:"path"`        //相对项目基目录，以/分隔
+	Remote      string    `json:"remote"`      //远程路径
+	Type        string    `json:"type"`        //dir、file，extra时为远程的类型
+	Diff        string    `json:"diff"`
+	LocalSize   int64     `json:"local_size,omitempty"`
+	RemoteSize  int64     `json:"remote_size,omitempty"`
+	LocalTime   time.Time `json:"local_time"`
+	RemoteTime  time.Time `json:"remote_time"`
+}
+
+type Diff struct {
+	Path    string       `json:"path"`
+	Remote  string       `json:"remote"`
+	Entries []*DiffEntry `json:"entries"`
+}
+
+//列出本地相对路径对应的远程目录
+func (p *Project) RemoteDir(rel string) (string, []*RemoteEntry, error) {
+	rel, err := cleanRel(rel)
+	if err != nil {
+		return "", nil, err
+	}
+	p.dirLock.RLock()
+	defer p.dirLock.RUnlock()
+	remote := p.remote(p.absolute(rel))
+	infos, err := p.client.ReadDir(remote)
+	if err != nil {
+		return remote, nil, err
+	}
+	entries := make([]*RemoteEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, remoteEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return remote, entries, nil
+}
+
+func remoteEntry(info os.FileInfo) *RemoteEntry {
+	entry := &RemoteEntry{
+		Name:       info.Name(),
+		Type:       "file",
+		Size:       info.Size(),
+		Mode:       info.Mode().String(),
+		ModifyTime: info.ModTime(),
+	}
+	if info.IsDir() {
+		entry.Type = "dir"
+		entry.Size = 0
+	}
+	return entry
+}
+
+//比较本地缓存的目录树与远程目录，depth小于0时不限制深度
+func (p *Project) Diff(rel string, depth int) (*Diff, error) {
+	p.dirLock.RLock()
+	defer p.dirLock.RUnlock()
+	return p.diff(rel, depth)
+}
+
+//同步子树的差异：缺失、大小不一致、过期的文件标记为变更后触发一次同步，
+//deleteExtra为true时直接删除远程多余的文件和目录
+func (p *Project) SyncDiff(rel string, deleteExtra bool) (*Diff, error) {
+	p.dirLock.Lock()
+	defer p.dirLock.Unlock()
+	diff, err := p.diff(rel, -1)
+	if err != nil {
+		return nil, err
+	}
+	client := newJournalClient(p, newCycle(time.Now()), p.client)
+	for _, entry := range diff.Entries {
+		switch entry.Diff {
+		case DiffExtra:
+			if !deleteExtra {
+				continue
+			}
+			if entry.Type == "dir" {
+				err = client.RemoveDirectory(entry.Remote)
+			}else{
+				err = client.Remove(entry.Remote)
+			}
+			if err != nil {
+				return diff, err
+			}
+		case DiffType:
+			//类型不一致时先删除远程，再按缺失处理
+			info, err := p.client.Stat(entry.Remote)
+			if err == nil && info.IsDir() {
+				err = client.RemoveDirectory(entry.Remote)
+			}else if err == nil {
+				err = client.Remove(entry.Remote)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return diff, err
+			}
+			if err := p.markChanged(client, entry); err != nil {
+				return diff, err
+			}
+		default:
+			if err := p.markChanged(client, entry); err != nil {
+				return diff, err
+			}
+		}
+	}
+	p.Sync()
+	return diff, nil
+}
+
+//将差异对应的本地文件标记为变更，下一次检测时返回并上传
+//远程缺失的目录直接创建，其中的文件标记为新增，避免子目录先于上级目录上传
+func (p *Project) markChanged(client sftp.Sftp, entry *DiffEntry) error {
+	abs := p.absolute(entry.Path)
+	if d, ok := p.Dirs.DirMap[abs]; ok {
+		return p.markMissing(client, d)
+	}
+	parent, ok := p.Dirs.DirMap[filepath.Dir(abs)]
+	if !ok {
+		return nil
+	}
+	for _, file := range parent.File {
+		if file.Name == abs && file.Status == dir.NotModify {
+			file.Status = dir.Modify
+		}
+	}
+	if parent.Status == dir.NotModify {
+		parent.Status = dir.Modify
+	}
+	return nil
+}
+
+func (p *Project) markMissing(client sftp.Sftp, d *dir.DirectoryStruct) error {
+	if err := client.Mkdir(p.remote(d.DirName)); err != nil {
+		return err
+	}
+	for _, file := range d.File {
+		if file.Status == dir.NotModify || file.Status == dir.Modify {
+			file.Status = dir.Add
+		}
+	}
+	if len(d.File) != 0 && d.Status == dir.NotModify {
+		d.Status = dir.Modify
+	}
+	for _, child := range d.DirChild {
+		if child.Status == dir.Delete || child.Status == dir.ShiftDelete {
+			continue
+		}
+		if err := p.markMissing(client, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Project) diff(rel string, depth int) (*Diff, error) {
+	rel, err := cleanRel(rel)
+	if err != nil {
+		return nil, err
+	}
+	abs := p.absolute(rel)
+	local, ok := p.Dirs.DirMap[abs]
+	if !ok {
+		return nil, fmt.Errorf("path %s not found: %w", rel, os.ErrNotExist)
+	}
+	diff := &Diff{
+		Path:    rel,
+		Remote:  p.remote(abs),
+		Entries: make([]*DiffEntry, 0),
+	}
+	info, err := p.client.Stat(diff.Remote)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		diff.Entries = append(diff.Entries, &DiffEntry{Path: rel, Remote: diff.Remote, Type: "dir", Diff: DiffMissing, LocalTime: local.ModifyTime})
+		return diff, nil
+	}
+	if !info.IsDir() {
+		diff.Entries = append(diff.Entries, &DiffEntry{Path: rel, Remote: diff.Remote, Type: "dir", Diff: DiffType})
+		return diff, nil
+	}
+	if err := p.diffDir(local, rel, diff.Remote, depth, diff); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+func (p *Project) diffDir(local *dir.DirectoryStruct, rel, remote string, depth int, diff *Diff) error {
+	infos, err := p.client.ReadDir(remote)
+	if err != nil {
+		return err
+	}
+	remoteInfos := make(map[string]os.FileInfo, len(infos))
+	for _, info := range infos {
+		remoteInfos[info.Name()] = info
+	}
+	//远程文件通常在对应目录下，路径映射或重命名规则映射到其他目录时单独查询
+	lookup := func(remotePath string) (os.FileInfo, error) {
+		if path.Dir(remotePath) == remote {
+			info, ok := remoteInfos[path.Base(remotePath)]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			delete(remoteInfos, path.Base(remotePath))
+			return info, nil
+		}
+		return p.client.Stat(remotePath)
+	}
+	for _, child := range local.DirChild {
+		if child.Status == dir.Delete || child.Status == dir.ShiftDelete {
+			continue
+		}
+		childRel := joinRel(rel, filepath.Base(child.DirName))
+		childRemote := p.remote(child.DirName)
+		info, err := lookup(childRemote)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			diff.Entries = append(diff.Entries, &DiffEntry{Path: childRel, Remote: childRemote, Type: "dir", Diff: DiffMissing, LocalTime: child.ModifyTime})
+			continue
+		}
+		if !info.IsDir() {
+			diff.Entries = append(diff.Entries, &DiffEntry{Path: childRel, Remote: childRemote, Type: "dir", Diff: DiffType})
+			continue
+		}
+		if depth != 0 {
+			if err := p.diffDir(child, childRel, childRemote, depth-1, diff); err != nil {
+				return err
+			}
+		}
+	}
+	for _, file := range local.File {
+		if file.Status == dir.Delete || file.Status == dir.ShiftDelete {
+			continue
+		}
+		name := filepath.Base(file.Name)
+		fileRemote := p.remote(file.Name)
+		tr := hook.MatchTransform(p.transforms, name)
+		if tr != nil {
+			fileRemote += tr.Suffix
+		}
+		entry := &DiffEntry{Path: joinRel(rel, name), Remote: fileRemote, Type: "file", LocalSize: file.Size, LocalTime: file.ModifyTime}
+		info, err := lookup(fileRemote)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			entry.Diff = DiffMissing
+			diff.Entries = append(diff.Entries, entry)
+			continue
+		}
+		entry.RemoteSize, entry.RemoteTime = info.Size(), info.ModTime()
+		switch {
+		case info.IsDir():
+			entry.Diff = DiffType
+		case tr == nil && info.Size() != file.Size: //转换后的大小与原文件不同，不比较
+			entry.Diff = DiffSize
+		case info.ModTime().Before(file.ModifyTime.Truncate(time.Second)): //远程修改时间为上传时间，精度为秒
+			entry.Diff = DiffOutdated
+		default:
+			continue
+		}
+		diff.Entries = append(diff.Entries, entry)
+	}
+	names := make([]string, 0, len(remoteInfos))
+	for name := range remoteInfos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		info := remoteInfos[name]
+		entry := &DiffEntry{Path: joinRel(rel, name), Remote: path.Join(remote, name), Type: "file", Diff: DiffExtra, RemoteSize: info.Size(), RemoteTime: info.ModTime()}
+		if info.IsDir() {
+			entry.Type = "dir"
+			entry.RemoteSize = 0
+		}
+		diff.Entries = append(diff.Entries, entry)
+	}
+	return nil
+}
+
+//本地路径对应的远程路径，远程基目录为/时基目录映射为空字符串，统一为/
+func (p *Project) remote(local string) string {
+	remote := p.mapper.Remote(local)
+	if len(remote) == 0 {
+		return "/"
+	}
+	return path.Clean(remote)
+}
+
+//去掉相对路径中的空段和.，包含..（按/或\\分隔）时返回ErrInvalidPath
+func cleanRel(rel string) (string, error) {
+	segments := make([]string, 0)
+	for _, seg := range strings.Split(rel, "/") {
+		if len(seg) == 0 || seg == "." {
+			continue
+		}
+		for _, part := range strings.Split(seg, "\\") {
+			if part == ".." {
+				return "", fmt.Errorf("%w: %s", ErrInvalidPath, rel)
+			}
+		}
+		segments = append(segments, seg)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+//相对路径转换为本地绝对路径
+func (p *Project) absolute(rel string) string {
+	rel = strings.Trim(rel, "/")
+	if len(rel) == 0 {
+		return p.Dirs.Dir.DirName
+	}
+	return p.Dirs.Dir.DirName + string(filepath.Separator) + strings.Join(strings.Split(rel, "/"), string(filepath.Separator))
+}
+
+func joinRel(parent, name string) string {
+	if len(parent) == 0 {
+		return name
+	}
+	return parent + "/" + name
+}
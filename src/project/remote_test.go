@@ -0,0 +1,330 @@
+package project
+
+import (
+	"bytes"
+	"conf"
+	"dir"
+	"errors"
+	"io/ioutil"
+	"mapping"
+	"metrics"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sftp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+//以本地目录模拟远程服务器的sftp客户端
+type dirClient struct {
+	root string
+}
+
+func (c *dirClient) path(remote string) string {
+	return filepath.Join(c.root, filepath.FromSlash(remote))
+}
+func (c *dirClient) Close() {}
+func (c *dirClient) Put(local, remote string) error {
+	content, err := ioutil.ReadFile(local)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path(remote), content, 0666)
+}
+func (c *dirClient) Mkdir(remote string) error {
+	if err := os.Mkdir(c.path(remote), 0777); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+func (c *dirClient) Remove(remote string) error {
+	return os.Remove(c.path(remote))
+}
+func (c *dirClient) RemoveDirectory(remote string) error {
+	return os.RemoveAll(c.path(remote))
+}
+func (c *dirClient) Run(cmd string, timeout time.Duration) (string, string, error) {
+	return "", "", nil
+}
+func (c *dirClient) Rename(oldRemote, newRemote string) error {
+	return os.Rename(c.path(oldRemote), c.path(newRemote))
+}
+func (c *dirClient) ReadDir(remote string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(c.path(remote))
+}
+func (c *dirClient) Stat(remote string) (os.FileInfo, error) {
+	return os.Stat(c.path(remote))
+}
+
+func newTestProject(t *testing.T) (*Project, string, string) {
+	local := filepath.Join(t.TempDir(), "site")
+	remote := t.TempDir()
+	os.MkdirAll(filepath.Join(local, "css"), 0777)
+	os.MkdirAll(filepath.Join(local, "js", "lib"), 0777)
+	ioutil.WriteFile(filepath.Join(local, "index.html"), []byte("<html>"), 0666)
+	ioutil.WriteFile(filepath.Join(local, "css", "a.css"), []byte("body{}"), 0666)
+	ioutil.WriteFile(filepath.Join(local, "js", "lib", "b.js"), []byte("var b"), 0666)
+	config := &conf.ProjectConfig{Name: "remote_test", LocalBaseDir: local, RemoteBaseDir: "/", StripBaseDir: true, LocalOs: "linux", RemoteOs: "linux"}
+	p := newProject(config)
+	p.mapper, _ = mapping.New(config, p.localSeparator, p.remoteSeparator)
+	p.client = &dirClient{root: remote}
+	t.Cleanup(p.deleteMetrics)
+	config.JournalFile = filepath.Join(t.TempDir(), "remote_test.journal")
+	if err := p.openJournal(config); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.journal.Close() })
+	if err := p.Dirs.Open(local); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.sftp([]string{local}); err != nil {
+		t.Fatal(err)
+	}
+	return p, local, remote
+}
+
+func diffs(diff *Diff) map[string]string {
+	res := make(map[string]string)
+	for _, entry := range diff.Entries {
+		res[entry.Path] = entry.Diff
+	}
+	return res
+}
+
+func TestProject_Diff(t *testing.T) {
+	p, _, remote := newTestProject(t)
+	diff, err := p.Diff("", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Entries) != 0 {
+		t.Fatalf("unexpected diff after full upload: %v", diffs(diff))
+	}
+	_, entries, err := p.RemoteDir("js")
+	if err != nil || len(entries) != 1 || entries[0].Name != "lib" || entries[0].Type != "dir" {
+		t.Errorf("remote dir js: %v %v", entries, err)
+	}
+
+	os.RemoveAll(filepath.Join(remote, "js"))
+	ioutil.WriteFile(filepath.Join(remote, "css", "a.css"), []byte("body{color:red}"), 0666)
+	ioutil.WriteFile(filepath.Join(remote, "old.html"), []byte("old"), 0666)
+	diff, err = p.Diff("", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{"js": DiffMissing, "css/a.css": DiffSize, "old.html": DiffExtra}
+	if got := diffs(diff); len(got) != len(expect) {
+		t.Fatalf("diff %v, expect %v", got, expect)
+	} else {
+		for path, d := range expect {
+			if got[path] != d {
+				t.Errorf("diff of %s is %s, expect %s", path, got[path], d)
+			}
+		}
+	}
+	if diff, _ := p.Diff("", 0); len(diff.Entries) != 2 { //不进入css
+		t.Errorf("depth 0 diff %v", diffs(diff))
+	}
+
+	if _, err := p.SyncDiff("", true); err != nil {
+		t.Fatal(err)
+	}
+	modify, err := p.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(modify)
+	if err := p.sftp(modify); err != nil {
+		t.Fatal(err)
+	}
+	if diff, _ := p.Diff("", -1); len(diff.Entries) != 0 {
+		t.Errorf("diff after sync %v", diffs(diff))
+	}
+	if _, err := os.Stat(filepath.Join(remote, "js", "lib", "b.js")); err != nil {
+		t.Errorf("missing directory not uploaded: %v", err)
+	}
+}
+
+//API传入的路径不能访问基目录之外的远程目录
+func TestProject_RemotePathTraversal(t *testing.T) {
+	p, _, _ := newTestProject(t)
+	decoded, _ := url.PathUnescape("%2e%2e/%2E%2E")
+	for _, rel := range []string{"..", "../..", "js/../..", "js/lib/../../..", `..\..`, decoded} {
+		if _, _, err := p.RemoteDir(rel); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("remote dir %q: %v", rel, err)
+		}
+		if _, err := p.Diff(rel, -1); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("diff %q: %v", rel, err)
+		}
+		if _, err := p.SyncDiff(rel, true); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("sync diff %q: %v", rel, err)
+		}
+	}
+	if _, entries, err := p.RemoteDir("./js//"); err != nil || len(entries) != 1 {
+		t.Errorf("remote dir ./js//: %v %v", entries, err)
+	}
+}
+
+//首次全量上传同样遵守传输窗口
+func TestProject_OpenInitialUpload(t *testing.T) {
+	remote := t.TempDir()
+	dialSftp = func(p *Project) (sftp.Sftp, error) {
+		return &dirClient{root: remote}, nil
+	}
+	defer func() { dialSftp = (*Project).dial }()
+	open := func(windows []*conf.TransferWindow) *Project {
+		local := filepath.Join(t.TempDir(), "site")
+		os.MkdirAll(local, 0777)
+		ioutil.WriteFile(filepath.Join(local, "index.html"), []byte("<html>"), 0666)
+		config := &conf.ProjectConfig{Name: "initial_test", LocalBaseDir: local, RemoteBaseDir: "/", StripBaseDir: true, LocalOs: "linux", RemoteOs: "linux",
+			SaveProject: filepath.Join(t.TempDir(), "initial.save"), CheckInterval: 10, TransferWindows: windows, TransferWindowsOnly: windows != nil}
+		p, err := Open(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	now := time.Now()
+	closed := []*conf.TransferWindow{{Start: now.Add(2 * time.Hour).Format("15:04"), End: now.Add(3 * time.Hour).Format("15:04")}}
+	p := open(closed)
+	time.Sleep(100 * time.Millisecond)
+	p.Close()
+	if _, err := os.Stat(filepath.Join(remote, "index.html")); !os.IsNotExist(err) {
+		t.Fatalf("uploaded outside transfer window: %v", err)
+	}
+
+	p = open(nil)
+	defer p.Close()
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(filepath.Join(remote, "index.html")); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("initial upload not done")
+}
+
+//首次全量上传嵌套的新目录时先创建上级目录
+func TestProject_OpenInitialUploadNested(t *testing.T) {
+	remote := t.TempDir()
+	dialSftp = func(p *Project) (sftp.Sftp, error) {
+		return &dirClient{root: remote}, nil
+	}
+	defer func() { dialSftp = (*Project).dial }()
+	local := filepath.Join(t.TempDir(), "site")
+	os.MkdirAll(filepath.Join(local, "a", "b", "c"), 0777)
+	ioutil.WriteFile(filepath.Join(local, "a", "b", "c", "x.txt"), []byte("x"), 0666)
+	config := &conf.ProjectConfig{Name: "nested_test", LocalBaseDir: local, RemoteBaseDir: "/", StripBaseDir: true, LocalOs: "linux", RemoteOs: "linux",
+		SaveProject: filepath.Join(t.TempDir(), "nested.save"), CheckInterval: 10}
+	p, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(filepath.Join(remote, "a", "b", "c", "x.txt")); err == nil {
+			if status := p.Status(); len(status.Failed) != 0 || len(status.LastError) != 0 {
+				t.Errorf("failed %v, error %s", status.Failed, status.LastError)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("nested initial upload not done, failed %v, error %s", p.Status().Failed, p.Status().LastError)
+}
+
+//manual模式下手动同步新建的嵌套目录
+func TestProject_ManualSyncNested(t *testing.T) {
+	remote := t.TempDir()
+	dialSftp = func(p *Project) (sftp.Sftp, error) {
+		return &dirClient{root: remote}, nil
+	}
+	defer func() { dialSftp = (*Project).dial }()
+	local := filepath.Join(t.TempDir(), "site")
+	os.MkdirAll(local, 0777)
+	ioutil.WriteFile(filepath.Join(local, "index.html"), []byte("<html>"), 0666)
+	config := &conf.ProjectConfig{Name: "manual_test", LocalBaseDir: local, RemoteBaseDir: "/", StripBaseDir: true, LocalOs: "linux", RemoteOs: "linux",
+		SaveProject: filepath.Join(t.TempDir(), "manual.save"), Mode: ModeManual, CheckInterval: 10}
+	p, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	//新文件在下一轮检测没有变化后才上传，多次触发直到上传完成
+	synced := func(rel string) bool {
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat(filepath.Join(remote, rel)); err == nil {
+				return true
+			}
+			p.Sync()
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+	if !synced("index.html") {
+		t.Fatalf("initial sync not done, error %s", p.Status().LastError)
+	}
+	os.MkdirAll(filepath.Join(local, "a", "b"), 0777)
+	ioutil.WriteFile(filepath.Join(local, "a", "b", "x.txt"), []byte("x"), 0666)
+	time.Sleep(100 * time.Millisecond) //定时检测多次，新目录及其子目录都在检测结果中
+	if !synced(filepath.Join("a", "b", "x.txt")) {
+		t.Fatalf("nested directory not synced, failed %v, error %s", p.Status().Failed, p.Status().LastError)
+	}
+	if status := p.Status(); len(status.Failed) != 0 || len(status.LastError) != 0 {
+		t.Errorf("failed %v, error %s", status.Failed, status.LastError)
+	}
+}
+
+type closeClient struct {
+	dirClient
+	closed bool
+}
+
+func (c *closeClient) Close() { c.closed = true }
+
+//打开失败时关闭已建立的连接并删除指标
+func TestProject_OpenCleanup(t *testing.T) {
+	client := &closeClient{dirClient: dirClient{root: t.TempDir()}}
+	dialSftp = func(p *Project) (sftp.Sftp, error) {
+		return client, nil
+	}
+	defer func() { dialSftp = (*Project).dial }()
+	config := &conf.ProjectConfig{Name: "cleanup_test", LocalBaseDir: t.TempDir(), RemoteBaseDir: "/", LocalOs: "linux", RemoteOs: "linux",
+		SaveProject: filepath.Join(t.TempDir(), "missing", "cleanup.save"), JournalFile: filepath.Join(t.TempDir(), "cleanup.journal")}
+	if _, err := Open(config); err == nil {
+		t.Fatal("expect save project error")
+	}
+	if !client.closed {
+		t.Error("sftp client not closed")
+	}
+	buf := new(bytes.Buffer)
+	metrics.WriteText(buf)
+	if strings.Contains(buf.String(), `project="cleanup_test"`) {
+		t.Errorf("metrics not deleted:\n%s", buf.String())
+	}
+}
+
+//重试只上传最近一次同步失败、仍有变更的目录
+func TestProject_RetryFailed(t *testing.T) {
+	p, local, _ := newTestProject(t)
+	if err := p.Retry(); !errors.Is(err, ErrNothingToRetry) {
+		t.Errorf("retry without failed dirs: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(local, "css", "b.css"), []byte("p{}"), 0666)
+	ioutil.WriteFile(filepath.Join(local, "js", "c.js"), []byte("var c"), 0666)
+	modify, err := p.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.setSync(modify, errors.New("upload failed"))
+	p.Dirs.DirMap[filepath.Join(local, "js")].Status = dir.NotModify //失败后已由其他同步上传
+	if err := p.Retry(); err != nil {
+		t.Fatal(err)
+	}
+	if failed := p.failedDirs(); len(failed) != 1 || failed[0] != filepath.Join(local, "css") {
+		t.Errorf("failed dirs %v", failed)
+	}
+}
@@ -0,0 +1,85 @@
+package project
+
+import (
+	"conf"
+	"fmt"
+	"sftp"
+	"time"
+)
+
+//所有项目共享的上传限速器
+var globalLimiter = sftp.NewLimiter(0)
+
+//设置所有项目共享的上传限速（KB/s），0表示不限速
+func SetGlobalBandwidth(limit int) {
+	globalLimiter.SetRate(int64(limit) * 1024)
+}
+
+//上传时间窗口
+type schedule struct {
+	windows []*window
+	only    bool
+	rate    int64
+}
+
+type window struct {
+	start int //一天中的分钟数
+	end   int
+	pause bool
+	rate  int64
+}
+
+func newSchedule(config *conf.ProjectConfig) (*schedule, error) {
+	s := &schedule{
+		windows: make([]*window, 0, len(config.TransferWindows)),
+		only:    config.TransferWindowsOnly,
+		rate:    int64(config.BandwidthLimit) * 1024,
+	}
+	for _, w := range config.TransferWindows {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(w.End)
+		if err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, &window{
+			start: start,
+			end:   end,
+			pause: w.Pause,
+			rate:  int64(w.BandwidthLimit) * 1024,
+		})
+	}
+	return s, nil
+}
+
+//返回当前是否允许上传以及项目限速（字节/秒），按配置顺序取第一个命中的窗口
+func (s *schedule) current(now time.Time) (bool, int64) {
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range s.windows {
+		if !w.contains(minute) {
+			continue
+		}
+		if w.rate > 0 {
+			return !w.pause, w.rate
+		}
+		return !w.pause, s.rate
+	}
+	return !s.only, s.rate
+}
+
+func (w *window) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid transfer window time:%s", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,151 @@
+package project
+
+import (
+	"dir"
+	"errors"
+	"event"
+	"time"
+)
+
+//没有同步失败的目录，不需要重试
+var ErrNothingToRetry = errors.New("no failed dirs to retry")
+
+//项目运行状态
+const (
+	StateRunning = "running"
+	StatePaused  = "paused"  //只检测变更，不自动上传
+	StateStopped = "stopped"
+)
+
+type Status struct {
+	Name          string    `json:"name"`
+	State         string    `json:"state"`
+	Mode          string    `json:"mode"`
+	LocalBaseDir  string    `json:"local_base_dir"`
+	RemoteAddress string    `json:"remote_address"`
+	RemoteBaseDir string    `json:"remote_base_dir"`
+	LastScan      time.Time `json:"last_scan"`
+	LastSync      time.Time `json:"last_sync"`       //最近一次同步成功的时间
+	LastError     string    `json:"last_error"`
+	LastErrorTime time.Time `json:"last_error_time"`
+	Pending       []string  `json:"pending"`         //待上传的目录（相对路径）
+	Failed        []string  `json:"failed"`          //最近一次同步失败的目录（相对路径），同步成功后清空
+}
+
+//返回项目状态的副本
+func (p *Project) Status() Status {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+	status := p.status
+	status.Pending = append([]string(nil), p.status.Pending...)
+	status.Failed = append([]string(nil), p.status.Failed...)
+	return status
+}
+
+//暂停自动上传，变更检测照常进行
+func (p *Project) Pause() {
+	p.setState(StatePaused)
+}
+
+func (p *Project) Resume() {
+	p.setState(StateRunning)
+	p.Sync()
+}
+
+//重新上传最近一次同步失败的目录，其他待上传的变更按正常流程上传
+func (p *Project) Retry() error {
+	if len(p.Status().Failed) == 0 {
+		return ErrNothingToRetry
+	}
+	select {
+	case p.retry <- struct{}{}:
+	default: //已有未处理的重试
+	}
+	return nil
+}
+
+//同步失败且仍有变更的目录（绝对路径），失败后已删除或已上传的目录忽略
+func (p *Project) failedDirs() []string {
+	failed := p.Status().Failed
+	p.dirLock.RLock()
+	defer p.dirLock.RUnlock()
+	res := make([]string, 0, len(failed))
+	for _, rel := range failed {
+		abs := p.absolute(rel)
+		if d, ok := p.Dirs.DirMap[abs]; ok && d.Status != dir.NotModify {
+			res = append(res, abs)
+		}
+	}
+	return res
+}
+
+func (p *Project) paused() bool {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+	return p.status.State == StatePaused
+}
+
+func (p *Project) setState(state string) {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+	if p.status.State != StateStopped {
+		p.status.State = state
+	}
+}
+
+func (p *Project) setScan(modify []string) {
+	pending := p.relative(modify)
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+	p.status.LastScan = time.Now()
+	p.status.Pending = pending
+	pendingDirs.Set(float64(len(pending)), p.ProjectName)
+}
+
+func (p *Project) setSync(modify []string, err error) {
+	failed := p.relative(modify)
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+	if err != nil {
+		p.status.Failed = failed
+		return
+	}
+	p.status.LastSync = time.Now()
+	p.status.Pending = nil
+	p.status.Failed = nil
+	pendingDirs.Set(0, p.ProjectName)
+	lastSyncTime.Set(float64(p.status.LastSync.Unix()), p.ProjectName)
+}
+
+func (p *Project) setError(err error) {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+	p.status.LastError = err.Error()
+	p.status.LastErrorTime = time.Now()
+}
+
+//在读锁保护下访问目录结构，避免与检测、上传同时进行
+func (p *Project) ReadDirs(fn func(dirs *dir.Directory)) {
+	p.dirLock.RLock()
+	defer p.dirLock.RUnlock()
+	fn(p.Dirs)
+}
+
+//检测变更
+func (p *Project) check() ([]string, error) {
+	p.publish(event.ScanStarted, event.Event{})
+	p.dirLock.Lock()
+	res, err := p.Dirs.CheckModify()
+	p.dirLock.Unlock()
+	if err != nil {
+		p.publish(event.ScanFinished, event.Event{Error: err.Error()})
+		return res, err
+	}
+	p.setScan(res)
+	dirs := p.relative(res)
+	p.publish(event.ScanFinished, event.Event{Dirs: dirs})
+	if len(dirs) > 0 {
+		p.publish(event.ChangeDetected, event.Event{Dirs: dirs})
+	}
+	return res, nil
+}
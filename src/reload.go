@@ -0,0 +1,122 @@
+package main
+
+import (
+	"conf"
+	"fmt"
+	"os"
+	"project"
+	"reflect"
+	"strings"
+	"time"
+	"util"
+)
+
+const (
+	defaultReloadInterval = 5 * time.Second
+	retryInterval         = 30 * time.Second //重试启动失败项目的间隔
+)
+
+//运行中的守护进程，重新加载配置时更新项目和日志配置
+type daemon struct {
+	file     string
+	config   *conf.Config
+	manager  *project.Manager
+}
+
+//启动项目，之后依次处理重新加载的请求，并定时重试启动失败的项目，done关闭后返回
+func (d *daemon) run(reloads <-chan string, done <-chan struct{}) {
+	d.manager.Apply(d.config)
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case reason := <-reloads:
+			d.reload(reason)
+		case <-ticker.C:
+			res := d.manager.Retry()
+			if len(res.Started) != 0 {
+				util.Info("failed projects restarted", util.F("started", res.Started), util.F("failed", res.Failed))
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+//已有未处理的重新加载请求时忽略，处理时读取最新的配置
+func notify(reloads chan<- string, reason string) {
+	select {
+	case reloads <- reason:
+	default:
+	}
+}
+
+//定时检查配置文件及其引入文件的修改时间和大小，文件变化或增删时通知重新加载，interval小于0时不检查
+//检查间隔在启动时确定，修改reload_interval需要重启
+func watchConfig(file string, interval int, notify chan<- struct{}) {
+	if interval < 0 {
+		return
+	}
+	period := time.Duration(interval) * time.Second
+	if period == 0 {
+		period = defaultReloadInterval
+	}
+	last := fingerprint(file)
+	for range time.Tick(period) {
+		current := fingerprint(file)
+		if len(current) == 0 || current == last {
+			continue
+		}
+		last = current
+		select {
+		case notify <- struct{}{}:
+		default: //已有未处理的通知
+		}
+	}
+}
+
+//所有配置文件的路径、修改时间和大小，主配置文件无法读取时返回空
+func fingerprint(file string) string {
+	files, err := conf.ConfigFiles(file)
+	if err != nil {
+		//主配置文件格式错误时只检查主配置文件，修正后重新加载
+		files = []string{file}
+	}
+	var buf strings.Builder
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			if f == file {
+				return ""
+			}
+			continue
+		}
+		fmt.Fprintf(&buf, "%s|%d|%d\n", f, info.ModTime().UnixNano(), info.Size())
+	}
+	return buf.String()
+}
+
+//重新读取配置文件，读取失败或校验不通过时保持当前配置运行
+//web服务的监听地址和认证配置需要重启后生效
+func (d *daemon) reload(reason string) {
+	config, err := conf.LoadConfig(d.file)
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		util.Error("reload config failed, keep running with current config", util.F("file", d.file), util.F("reason", reason), util.F("error", err))
+		return
+	}
+	if !reflect.DeepEqual(config.Log, d.config.Log) {
+		if err := util.ConfigureLog(config.Log); err != nil {
+			util.Error("reload log config failed", util.F("error", err))
+		}
+	}
+	if !reflect.DeepEqual(config.Web, d.config.Web) {
+		util.Warn("web config changed, restart required to take effect", util.F("file", d.file))
+	}
+	res := d.manager.Apply(config)
+	d.config = config
+	util.Info("config reloaded", util.F("file", d.file), util.F("reason", reason),
+		util.F("started", res.Started), util.F("stopped", res.Stopped), util.F("restarted", res.Restarted), util.F("failed", res.Failed))
+}
@@ -1,6 +1,7 @@
 package sftp
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
@@ -16,6 +17,10 @@ type Sftp interface {
 	Mkdir(remote string) error
 	Remove(remote string) error
 	RemoveDirectory(remote string) error
+	Run(cmd string, timeout time.Duration) (string, string, error)
+	Rename(oldRemote, newRemote string) error
+	ReadDir(remote string) ([]os.FileInfo, error)
+	Stat(remote string) (os.FileInfo, error)
 }
 
 
@@ -25,6 +30,24 @@ type  sftp_ struct{
 	passwd string
 	sshConn *ssh.Client
 	sftpClient *sftp.Client
+	limiters []*Limiter
+	progress func(local string, written, total int64)
+}
+
+type Option func(*sftp_)
+
+//上传时依次经过的限速器，如全局限速和项目限速
+func WithLimiter(limiters ...*Limiter) Option {
+	return func(s *sftp_) {
+		s.limiters = append(s.limiters, limiters...)
+	}
+}
+
+//上传过程中每写入一块数据回调一次，written为已写入的字节数，total为文件大小
+func WithProgress(progress func(local string, written, total int64)) Option {
+	return func(s *sftp_) {
+		s.progress = progress
+	}
 }
 
 func NewClient(address, user, passwd string) Sftp {
@@ -37,7 +60,7 @@ func NewClient(address, user, passwd string) Sftp {
 	}
 }
 
-func Dial(address, user, passwd string, timeout time.Duration) (Sftp, error) {
+func Dial(address, user, passwd string, timeout time.Duration, opts ...Option) (Sftp, error) {
 	s := &sftp_{
 		address:address,
 		user:user,
@@ -45,6 +68,9 @@ func Dial(address, user, passwd string, timeout time.Duration) (Sftp, error) {
 		sshConn:    nil,
 		sftpClient: nil,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
 	callBack := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 		return nil
 	}
@@ -102,6 +128,9 @@ func (s *sftp_) Put(local, remote string) error {
 		if err != nil && err != io.EOF{
 			return fmt.Errorf("local Read %s failed:%v", local, err)
 		}
+		for _, limiter := range s.limiters {
+			limiter.Wait(readLen)
+		}
 		if _, err := remoteFp.Write(content[:readLen]); err != nil {
 			return fmt.Errorf("remote Write %s failed:%v", local, err)
 		}
@@ -109,6 +138,9 @@ func (s *sftp_) Put(local, remote string) error {
 			break
 		}
 		total+=readLen
+		if s.progress != nil {
+			s.progress(local, int64(total), info.Size())
+		}
 		if int64(total) >= info.Size() {
 			break
 		}
@@ -145,6 +177,36 @@ func (s *sftp_) Remove(remote string) error {
 	}
 	return err
 }
+//重命名远程文件或目录，优先使用posix-rename扩展以覆盖已存在的目标文件
+func (s *sftp_) Rename(oldRemote, newRemote string) error {
+	err := s.sftpClient.PosixRename(oldRemote, newRemote)
+	if err == nil {
+		return nil
+	}
+	if err := s.sftpClient.Rename(oldRemote, newRemote); err != nil {
+		return fmt.Errorf("sftp Rename %s to %s failed:%v", oldRemote, newRemote, err)
+	}
+	return nil
+}
+//列出远程目录
+func (s *sftp_) ReadDir(remote string) ([]os.FileInfo, error) {
+	infos, err := s.sftpClient.ReadDir(remote)
+	if err != nil {
+		return nil, fmt.Errorf("sftp ReadDir %s failed:%w", remote, err)
+	}
+	return infos, nil
+}
+//查询远程文件或目录，不存在时返回的错误满足os.IsNotExist
+func (s *sftp_) Stat(remote string) (os.FileInfo, error) {
+	info, err := s.sftpClient.Stat(remote)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("sftp Stat %s failed:%v", remote, err)
+	}
+	return info, nil
+}
 //删除目录
 //API本身不支持包含文件的目录
 //此时封装后的api支持删除包含文件的目录
@@ -178,4 +240,42 @@ func (s *sftp_) RemoveDirectory(remote string) error {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+//在远程服务器上执行命令，返回标准输出和标准错误
+//timeout小于等于0时不限制执行时间
+func (s *sftp_) Run(cmd string, timeout time.Duration) (string, string, error) {
+	session, err := s.sshConn.NewSession()
+	if err != nil {
+		return "", "", fmt.Errorf("ssh NewSession failed:%v", err)
+	}
+	defer session.Close()
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if err := session.Start(cmd); err != nil {
+		return "", "", fmt.Errorf("ssh Start %s failed:%v", cmd, err)
+	}
+	done := make(chan error, 1)
+	go func(){
+		done <- session.Wait()
+	}()
+	if timeout <= 0 {
+		err = <-done
+	}else{
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case err = <-done:
+		case <-timer.C:
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+			<-done
+			return stdout.String(), stderr.String(), fmt.Errorf("ssh Run %s timeout after %v", cmd, timeout)
+		}
+	}
+	if err != nil {
+		return stdout.String(), stderr.String(), fmt.Errorf("ssh Run %s failed:%v", cmd, err)
+	}
+	return stdout.String(), stderr.String(), nil
+}
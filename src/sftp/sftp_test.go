@@ -59,4 +59,21 @@ func TestSftp__RemoveDirectory(t *testing.T) {
 	if err != nil {
 		t.Errorf("put failed, err:%v", err)
 	}
-}
\ No newline at end of file
+}
+func TestLimiter_Wait(t *testing.T) {
+	limiter := NewLimiter(100 * 1024)
+	start := time.Now()
+	for i := 0; i < 75; i++ {
+		limiter.Wait(4096)
+	}
+	//桶内1秒的令牌可以直接取出，剩余200KB需要等待约2秒
+	if cost := time.Since(start); cost < 1500*time.Millisecond || cost > 3*time.Second {
+		t.Errorf("transfer 300KB at 100KB/s cost %v", cost)
+	}
+	limiter.SetRate(0)
+	start = time.Now()
+	limiter.Wait(1 << 30)
+	if cost := time.Since(start); cost > 10*time.Millisecond {
+		t.Errorf("unlimited wait cost %v", cost)
+	}
+}
@@ -1,68 +1,391 @@
 package util
 
 import (
+	"bytes"
+	"conf"
+	"encoding/json"
 	"fmt"
+	"io"
+	"metrics"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+//日志级别
+type Level int
+
+const (
+	D Level = iota
+	I
+	W
+	E
+)
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (l Level) String() string {
+	if l < D || l > E {
+		return fmt.Sprint("LEVEL", int(l))
+	}
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return D, nil
+	case "", "info":
+		return I, nil
+	case "warn", "warning":
+		return W, nil
+	case "error":
+		return E, nil
+	}
+	return I, fmt.Errorf("unknown log level:%s", s)
+}
+
+//日志输出
 const (
-	Open = true
-	E = "ERROR"
-	I = "INFO"
-	D = "DEBUG"
-	Sync = false
-	Level = D
-	LogFile = `E:\workspace\go\go-auto-sftp-check-modify\src\log\error.log`
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
 )
 
-var recordLog *os.File
-var chanLog chan string
+//日志格式
+const (
+	FormatText = "text"
+	FormatJson = "json"
+)
+
+//队列满时的处理方式
+const (
+	OverflowDrop  = "drop"  //丢弃并计数，不阻塞调用者
+	OverflowBlock = "block" //等待写入，不丢失日志
+)
+
+const defaultLogBuffer = 1024
+
+var droppedTotal = metrics.NewCounterVec("autosftp_log_dropped_total", "Number of log messages dropped because the log queue was full.")
+
+var dropped uint64
 
 func init() {
-	if !Open && Sync {
-		return
+	droppedTotal.Add(0)
+}
+
+//返回队列满时丢弃的日志数
+func DroppedLogs() uint64 {
+	return atomic.LoadUint64(&dropped)
+}
+
+//结构化字段，常用的有project、path、op
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+//一条日志
+type entry struct {
+	time   time.Time
+	level  Level
+	caller string
+	msg    string
+	fields []Field
+}
+
+//日志的输出目标，syslog自带时间和级别，由sink自行处理格式
+type sink interface {
+	write(e *entry) error
+	close() error
+}
+
+type logger struct {
+	lock  sync.RWMutex              //写日志时加读锁，重新配置时加写锁，保证旧的输出关闭后不再写入
+	level Level
+	sink  sink
+}
+
+//未配置时输出到标准错误，级别为INFO
+var std = &logger{
+	level: I,
+	sink:  &writerSink{w: os.Stderr, format: FormatText},
+}
+
+//按配置重新设置日志，config为nil时使用默认配置，原输出在设置成功后关闭（写完队列中的日志）
+func ConfigureLog(config *conf.LogConfig) error {
+	if config == nil {
+		config = new(conf.LogConfig)
 	}
-	recordLogFile := fmt.Sprint(LogFile,".",time.Now().Format("20060102-150405"))
-	fp, err := os.Create(recordLogFile)
+	level, err := ParseLevel(config.Level)
 	if err != nil {
-		panic(fmt.Sprintf("create log file failed, fileName:%s", LogFile))
-	}
-	recordLog = fp
-	chanLog = make(chan string, 100)
-	go func(){
-		for  {
-			select {
-			case res := <-chanLog:
-				recordLog.WriteString(res)
-			}
+		return err
+	}
+	format := strings.ToLower(config.Format)
+	if format == "" {
+		format = FormatText
+	}
+	if format != FormatText && format != FormatJson {
+		return fmt.Errorf("unknown log format:%s", config.Format)
+	}
+	overflow := strings.ToLower(config.Overflow)
+	if overflow == "" {
+		overflow = OverflowDrop
+	}
+	if overflow != OverflowDrop && overflow != OverflowBlock {
+		return fmt.Errorf("unknown log overflow:%s", config.Overflow)
+	}
+	s, err := newSink(config, format)
+	if err != nil {
+		return err
+	}
+	buffer := config.Buffer
+	if buffer <= 0 {
+		buffer = defaultLogBuffer
+	}
+	s = newAsyncSink(s, buffer, overflow == OverflowBlock)
+	std.lock.Lock()
+	old := std.sink
+	std.level, std.sink = level, s
+	std.lock.Unlock()
+	return old.close()
+}
+
+func newSink(config *conf.LogConfig, format string) (sink, error) {
+	switch strings.ToLower(config.Output) {
+	case "", OutputStderr:
+		return &writerSink{w: os.Stderr, format: format}, nil
+	case OutputStdout:
+		return &writerSink{w: os.Stdout, format: format}, nil
+	case OutputFile:
+		if len(config.File) == 0 {
+			return nil, fmt.Errorf("log output file requires file")
 		}
-	}()
+		maxAge := time.Duration(config.MaxAge) * 24 * time.Hour
+		w, err := newRotateWriter(config.File, int64(config.MaxSize)*1024*1024, strings.ToLower(config.Rotate), config.MaxBackups, maxAge, config.Compress)
+		if err != nil {
+			return nil, err
+		}
+		return &writerSink{w: w, closer: w, format: format}, nil
+	case OutputSyslog:
+		return newSyslogSink(config, format)
+	}
+	return nil, fmt.Errorf("unknown log output:%s", config.Output)
+}
+
+//写完队列中的日志并关闭输出，之后的日志输出到标准错误，退出前调用
+func CloseLog() error {
+	std.lock.Lock()
+	old := std.sink
+	std.sink = &writerSink{w: os.Stderr, format: FormatText}
+	std.lock.Unlock()
+	return old.close()
+}
+
+func Enabled(level Level) bool {
+	std.lock.RLock()
+	defer std.lock.RUnlock()
+	return level >= std.level
 }
 
-var LogPrint func(string, string, string, string, string) = func(desc string, level string, funcName string, label string, msg string){
-	if !Open {
+func Debug(msg string, fields ...Field) {
+	std.log(D, msg, fields)
+}
+
+func Info(msg string, fields ...Field) {
+	std.log(I, msg, fields)
+}
+
+func Warn(msg string, fields ...Field) {
+	std.log(W, msg, fields)
+}
+
+func Error(msg string, fields ...Field) {
+	std.log(E, msg, fields)
+}
+
+func (l *logger) log(level Level, msg string, fields []Field) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if level < l.level {
 		return
 	}
-	if Level == I && level == D {
-		return
+	e := &entry{
+		time:   time.Now(),
+		level:  level,
+		msg:    msg,
+		fields: fields,
 	}
-	if Level == E && (level == D || level == I) {
-		return
+	//调用栈：Info等导出函数 -> log -> 此处
+	if _, file, n, ok := runtime.Caller(2); ok {
+		e.caller = fmt.Sprintf("%s:%d", filepath.Base(file), n)
 	}
-	now := time.Now().Format("2006-1-2 15:04:05.000000000")
-	_, file, n, ok := runtime.Caller(1)
-	var info string = ""
-	if ok {
-		info = fmt.Sprintf("[%s][%s][%s][%s:%d][%s][%s]%s\n", now, desc, level, filepath.Base(file), n, funcName, label, msg )
-	}else{
-		info = fmt.Sprintf("[%s][%s][%s][%s][%s]%s\n", now, desc, level, funcName, label, msg )
+	if err := l.sink.write(e); err != nil {
+		fmt.Fprintln(os.Stderr, "write log failed:", err)
 	}
-	if Sync {
-		fmt.Print(info)
-		return
+}
+
+type writerSink struct {
+	lock   sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	format string
+}
+
+func (s *writerSink) write(e *entry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err := s.w.Write(encode(e, s.format, true))
+	return err
+}
+
+func (s *writerSink) close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+//在单独的goroutine中写日志，慢速的磁盘或syslog不阻塞调用者
+type asyncSink struct {
+	sink
+	ch       chan *entry
+	block    bool
+	done     chan struct{}
+	dropped  uint64 //本输出丢弃的日志数
+	reported uint64 //已经记录过的丢弃数
+}
+
+func newAsyncSink(s sink, buffer int, block bool) *asyncSink {
+	a := &asyncSink{
+		sink:  s,
+		ch:    make(chan *entry, buffer),
+		block: block,
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *asyncSink) write(e *entry) error {
+	if a.block {
+		a.ch <- e
+		return nil
+	}
+	select {
+	case a.ch <- e:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+		atomic.AddUint64(&dropped, 1)
+		droppedTotal.Inc()
+	}
+	return nil
+}
+
+func (a *asyncSink) run() {
+	defer close(a.done)
+	for e := range a.ch {
+		a.output(e)
+		//队列有空闲后记录一次期间丢弃的日志数
+		if n := atomic.LoadUint64(&a.dropped); n != a.reported && len(a.ch) == 0 {
+			a.output(&entry{time: time.Now(), level: W, msg: "log messages dropped, log queue full", fields: []Field{F("dropped", n-a.reported)}})
+			a.reported = n
+		}
+	}
+}
+
+func (a *asyncSink) output(e *entry) {
+	if err := a.sink.write(e); err != nil {
+		fmt.Fprintln(os.Stderr, "write log failed:", err)
+	}
+}
+
+//关闭队列，等待已入队的日志写完后关闭输出
+func (a *asyncSink) close() error {
+	close(a.ch)
+	<-a.done
+	return a.sink.close()
+}
+
+//按格式编码一行日志，withHeader为false时不输出时间和级别
+func encode(e *entry, format string, withHeader bool) []byte {
+	var buf bytes.Buffer
+	if format == FormatJson {
+		buf.WriteByte('{')
+		first := true
+		add := func(key string, value interface{}) {
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			k, _ := json.Marshal(key)
+			v, err := json.Marshal(jsonValue(value))
+			if err != nil {
+				v, _ = json.Marshal(fmt.Sprint(value))
+			}
+			buf.Write(k)
+			buf.WriteByte(':')
+			buf.Write(v)
+		}
+		if withHeader {
+			add("time", e.time.Format(time.RFC3339Nano))
+			add("level", e.level.String())
+		}
+		if len(e.caller) != 0 {
+			add("caller", e.caller)
+		}
+		add("msg", e.msg)
+		for _, f := range e.fields {
+			add(f.Key, f.Value)
+		}
+		buf.WriteString("}\n")
+		return buf.Bytes()
+	}
+	if withHeader {
+		fmt.Fprintf(&buf, "%s %-5s ", e.time.Format("2006-01-02 15:04:05.000"), e.level.String())
+	}
+	if len(e.caller) != 0 {
+		fmt.Fprintf(&buf, "[%s] ", e.caller)
+	}
+	buf.WriteString(e.msg)
+	for _, f := range e.fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		buf.WriteString(textValue(f.Value))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+//error等类型编码为字符串
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+//包含空白、引号或等号的值加引号，保证一行一条日志
+func textValue(value interface{}) string {
+	s := fmt.Sprint(jsonValue(value))
+	if len(s) == 0 || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
 	}
-	chanLog <- info
+	return s
 }
@@ -0,0 +1,83 @@
+package util
+
+import (
+	"conf"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	e := &entry{
+		time:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local),
+		level:  W,
+		caller: "log_test.go:10",
+		msg:    "upload failed",
+		fields: []Field{F("project", "demo"), F("path", "sub dir/a.txt"), F("error", errors.New("broken pipe"))},
+	}
+	text := string(encode(e, FormatText, true))
+	expect := `2024-01-02 03:04:05.000 WARN  [log_test.go:10] upload failed project=demo path="sub dir/a.txt" error="broken pipe"` + "\n"
+	if text != expect {
+		t.Errorf("text got %q, expect %q", text, expect)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(encode(e, FormatJson, true), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["level"] != "WARN" || m["msg"] != "upload failed" || m["path"] != "sub dir/a.txt" || m["error"] != "broken pipe" {
+		t.Errorf("unexpected json %v", m)
+	}
+	if err := json.Unmarshal(encode(e, FormatJson, false), &m); err != nil {
+		t.Fatal(err)
+	}
+	if text := string(encode(e, FormatText, false)); strings.Contains(text, "WARN") {
+		t.Errorf("text without header %q", text)
+	}
+}
+
+func TestConfigureLog(t *testing.T) {
+	defer CloseLog()
+	file := filepath.Join(t.TempDir(), "log", "autosftp.log")
+	if err := ConfigureLog(&conf.LogConfig{Level: "warn", Format: "json", Output: "file", File: file}); err != nil {
+		t.Fatal(err)
+	}
+	Info("ignored", F("project", "demo"))
+	Warn("kept", F("project", "demo"), F("op", "put"))
+	if Enabled(I) || !Enabled(E) {
+		t.Errorf("unexpected enabled levels")
+	}
+	if err := CloseLog(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expect 1 line, got %q", content)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["msg"] != "kept" || m["op"] != "put" || !strings.HasPrefix(m["caller"].(string), "log_test.go:") {
+		t.Errorf("unexpected log %v", m)
+	}
+
+	invalid := []*conf.LogConfig{
+		{Level: "verbose"},
+		{Format: "xml"},
+		{Output: "file"},
+		{Output: "kafka"},
+	}
+	for _, config := range invalid {
+		if err := ConfigureLog(config); err == nil {
+			t.Errorf("config %+v should be invalid", config)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package util
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//按时间轮转的周期
+const (
+	RotateHourly = "hourly"
+	RotateDaily  = "daily"
+)
+
+const backupTimeFormat = "20060102-150405.000"
+
+//写入日志文件，超过大小或跨越周期时将当前文件重命名为file.时间，并按数量和时间清理旧文件
+//只在日志写入goroutine中使用，不加锁，压缩和清理在后台goroutine中执行
+type rotateWriter struct {
+	file       string
+	maxSize    int64         //0表示不按大小轮转
+	period     string        //为空时不按时间轮转
+	maxBackups int           //0表示不限制
+	maxAge     time.Duration //0表示不限制
+	compress   bool
+	fp         *os.File
+	size       int64
+	next       time.Time     //下一次按时间轮转的时间
+	now        func() time.Time
+	background sync.Mutex    //同一时间只有一个后台压缩、清理
+	pending    sync.WaitGroup
+}
+
+func newRotateWriter(file string, maxSize int64, period string, maxBackups int, maxAge time.Duration, compress bool) (*rotateWriter, error) {
+	if period != "" && period != RotateHourly && period != RotateDaily {
+		return nil, fmt.Errorf("unknown log rotate:%s", period)
+	}
+	w := &rotateWriter{
+		file:       file,
+		maxSize:    maxSize,
+		period:     period,
+		maxBackups: maxBackups,
+		maxAge:     maxAge,
+		compress:   compress,
+		now:        time.Now,
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	fp, err := os.OpenFile(w.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	w.fp, w.size = fp, info.Size()
+	//已有的日志文件按最后修改时间计算周期，重启后跨越周期的文件在第一次写入时轮转
+	start := w.now()
+	if w.size > 0 {
+		start = info.ModTime()
+	}
+	w.next = nextPeriod(start, w.period)
+	return nil
+}
+
+//返回t所在周期的结束时间，period为空时返回零值
+func nextPeriod(t time.Time, period string) time.Time {
+	switch period {
+	case RotateHourly:
+		return t.Truncate(time.Hour).Add(time.Hour)
+	case RotateDaily:
+		y, m, d := t.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Time{}
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	if w.fp == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	bySize := w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize
+	byTime := !w.next.IsZero() && !w.now().Before(w.next)
+	if bySize || (byTime && w.size > 0) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}else if byTime {
+		w.next = nextPeriod(w.now(), w.period)
+	}
+	n, err := w.fp.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotateWriter) rotate() error {
+	if err := w.fp.Close(); err != nil {
+		return err
+	}
+	w.fp = nil
+	backup := w.file + "." + w.now().Format(backupTimeFormat)
+	if err := os.Rename(w.file, backup); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	now := w.now()
+	if !w.compress {
+		w.clean(now)
+		return nil
+	}
+	//压缩大文件耗时较长，不能阻塞日志写入，压缩后再清理，避免同一文件压缩前后被计为两个
+	w.pending.Add(1)
+	go func(){
+		defer w.pending.Done()
+		w.background.Lock()
+		defer w.background.Unlock()
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintln(os.Stderr, "compress log failed:", err)
+		}
+		w.clean(now)
+	}()
+	return nil
+}
+
+//按数量和时间删除旧的日志文件，文件名中的时间格式相同，按名称排序即按时间排序
+func (w *rotateWriter) clean(now time.Time) {
+	if w.maxBackups <= 0 && w.maxAge <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(w.file + ".*")
+	if err != nil {
+		return
+	}
+	backups := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if isBackup(w.file, match) {
+			backups = append(backups, match)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, backup := range backups {
+		remove := w.maxBackups > 0 && i >= w.maxBackups
+		if !remove && w.maxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && now.Sub(info.ModTime()) > w.maxAge {
+				remove = true
+			}
+		}
+		if remove {
+			os.Remove(backup)
+		}
+	}
+}
+
+func compressFile(file string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(file+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if e := gz.Close(); err == nil {
+		err = e
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(file + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(file)
+}
+
+//等待后台的压缩完成后返回
+func (w *rotateWriter) Close() error {
+	w.pending.Wait()
+	if w.fp == nil {
+		return nil
+	}
+	err := w.fp.Close()
+	w.fp = nil
+	return err
+}
+
+//只清理轮转生成的文件，file.*中不符合时间格式的文件保留
+func isBackup(file, name string) bool {
+	suffix := strings.TrimSuffix(strings.TrimPrefix(name, file+"."), ".gz")
+	_, err := time.Parse(backupTimeFormat, suffix)
+	return err == nil
+}
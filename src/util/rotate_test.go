@@ -0,0 +1,183 @@
+package util
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func backups(t *testing.T, file string) []string {
+	matches, err := filepath.Glob(file + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestRotateWriter_Size(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "autosftp.log")
+	w, err := newRotateWriter(file, 100, "", 2, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	w.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 10; i++ {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	info, err := os.Stat(file)
+	if err != nil || info.Size() > 100 {
+		t.Fatalf("current log %v %v", info, err)
+	}
+	list := backups(t, file)
+	if len(list) != 2 {
+		t.Fatalf("expect 2 backups, got %v", list)
+	}
+	for _, backup := range list {
+		if !strings.HasSuffix(backup, ".gz") {
+			t.Errorf("backup %s not compressed", backup)
+			continue
+		}
+		fp, _ := os.Open(backup)
+		gz, err := gzip.NewReader(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(gz)
+		fp.Close()
+		if string(content) != line+line {
+			t.Errorf("backup %s content %q", backup, content)
+		}
+	}
+}
+
+//压缩在后台执行，不阻塞写入
+func TestRotateWriter_CompressBackground(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "autosftp.log")
+	w, err := newRotateWriter(file, 10, "", 0, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.background.Lock() //模拟耗时的压缩
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 3; i++ {
+			if _, err := w.Write([]byte("0123456789")); err != nil {
+				done <- err
+				return
+			}
+			time.Sleep(2 * time.Millisecond) //轮转文件名精确到毫秒
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write blocked by compression")
+	}
+	w.background.Unlock()
+	w.Close()
+	list := backups(t, file)
+	if len(list) != 2 {
+		t.Fatalf("expect 2 backups, got %v", list)
+	}
+	for _, backup := range list {
+		if !strings.HasSuffix(backup, ".gz") {
+			t.Errorf("backup %s not compressed after close", backup)
+		}
+	}
+}
+
+func TestRotateWriter_Time(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "autosftp.log")
+	ioutil.WriteFile(file+".keep", []byte("not a backup"), 0644)
+	w, err := newRotateWriter(file, 0, RotateDaily, 0, 48*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	now := time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)
+	w.now = func() time.Time { return now }
+	w.next = nextPeriod(now, RotateDaily)
+	w.Write([]byte("day1\n"))
+	now = now.Add(2 * time.Hour)
+	w.Write([]byte("day2\n"))
+	list := backups(t, file)
+	if len(list) != 2 || !strings.HasSuffix(list[0], ".20240102-010000.000") {
+		t.Fatalf("unexpected backups %v", list)
+	}
+	content, _ := ioutil.ReadFile(list[0])
+	if string(content) != "day1\n" {
+		t.Errorf("backup content %q", content)
+	}
+	//超过保留时间的轮转文件在下一次轮转时删除，其他文件保留
+	os.Chtimes(list[0], now.Add(-72*time.Hour), now.Add(-72*time.Hour))
+	now = now.Add(24 * time.Hour)
+	w.Write([]byte("day3\n"))
+	list = backups(t, file)
+	if len(list) != 2 || !strings.HasSuffix(list[0], ".20240103-010000.000") || !strings.HasSuffix(list[1], ".keep") {
+		t.Errorf("unexpected backups after clean %v", list)
+	}
+}
+
+//写入前等待信号的输出，模拟慢速磁盘
+type slowSink struct {
+	release chan struct{}
+	lines   []string
+}
+
+func (s *slowSink) write(e *entry) error {
+	<-s.release
+	s.lines = append(s.lines, e.msg)
+	return nil
+}
+
+func (s *slowSink) close() error {
+	return nil
+}
+
+func TestAsyncSink(t *testing.T) {
+	inner := &slowSink{release: make(chan struct{})}
+	a := newAsyncSink(inner, 2, false)
+	before := DroppedLogs()
+	for i := 0; i < 10; i++ {
+		a.write(&entry{msg: "m"})
+	}
+	//第一条被写入goroutine取出后阻塞，队列中2条，其余丢弃
+	if n := DroppedLogs() - before; n < 6 || n > 8 {
+		t.Errorf("dropped %d logs", n)
+	}
+	close(inner.release)
+	if err := a.close(); err != nil {
+		t.Fatal(err)
+	}
+	last := inner.lines[len(inner.lines)-1]
+	if len(inner.lines) < 3 || last != "log messages dropped, log queue full" {
+		t.Errorf("unexpected lines %v", inner.lines)
+	}
+
+	inner = &slowSink{release: make(chan struct{})}
+	a = newAsyncSink(inner, 1, true)
+	close(inner.release)
+	for i := 0; i < 100; i++ {
+		a.write(&entry{msg: "m"})
+	}
+	a.close()
+	if len(inner.lines) != 100 {
+		t.Errorf("block policy wrote %d lines, expect 100", len(inner.lines))
+	}
+}
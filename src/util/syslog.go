@@ -0,0 +1,43 @@
+//go:build !windows
+
+package util
+
+import (
+	"conf"
+	"log/syslog"
+)
+
+type syslogSink struct {
+	w      *syslog.Writer
+	format string
+}
+
+//network、address为空时连接本机的syslog
+func newSyslogSink(config *conf.LogConfig, format string) (sink, error) {
+	tag := config.SyslogTag
+	if len(tag) == 0 {
+		tag = "go-auto-sftp"
+	}
+	w, err := syslog.Dial(config.SyslogNetwork, config.SyslogAddress, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w, format: format}, nil
+}
+
+func (s *syslogSink) write(e *entry) error {
+	msg := string(encode(e, s.format, false))
+	switch e.level {
+	case D:
+		return s.w.Debug(msg)
+	case I:
+		return s.w.Info(msg)
+	case W:
+		return s.w.Warning(msg)
+	}
+	return s.w.Err(msg)
+}
+
+func (s *syslogSink) close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,11 @@
+package util
+
+import (
+	"conf"
+	"errors"
+)
+
+//windows没有syslog
+func newSyslogSink(config *conf.LogConfig, format string) (sink, error) {
+	return nil, errors.New("syslog output is not supported on windows")
+}
@@ -0,0 +1,148 @@
+package web
+
+import (
+	"conf"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//角色
+const (
+	RoleRead  = "read"  //只能查询
+	RoleAdmin = "admin" //可以触发同步、暂停、恢复
+)
+
+//浏览器无法为EventSource设置请求头，查询请求也可以通过查询参数或cookie传递token
+const (
+	tokenParam  = "token"
+	tokenCookie = "autosftp_token"
+)
+
+type authenticator struct {
+	tokens map[string]string //token -> role
+	users  map[string]*conf.UserConfig
+	lock   sync.Mutex
+	cache  map[[sha256.Size]byte]bool //已验证通过的用户名和密码，避免每次请求都计算bcrypt
+}
+
+func newAuthenticator(config *conf.WebConfig) (*authenticator, error) {
+	a := &authenticator{
+		tokens: make(map[string]string),
+		users:  make(map[string]*conf.UserConfig),
+		cache:  make(map[[sha256.Size]byte]bool),
+	}
+	if config == nil {
+		return a, nil
+	}
+	for _, token := range config.Tokens {
+		if len(token.Token) == 0 {
+			return nil, fmt.Errorf("token[%s] is empty", token.Name)
+		}
+		role, err := checkRole(token.Role)
+		if err != nil {
+			return nil, fmt.Errorf("token[%s]:%v", token.Name, err)
+		}
+		a.tokens[string(token.Token)] = role
+	}
+	for _, user := range config.Users {
+		role, err := checkRole(user.Role)
+		if err != nil {
+			return nil, fmt.Errorf("user[%s]:%v", user.User, err)
+		}
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("user[%s] password_hash is not a bcrypt hash:%v", user.User, err)
+		}
+		a.users[user.User] = &conf.UserConfig{User: user.User, PasswordHash: user.PasswordHash, Role: role}
+	}
+	return a, nil
+}
+
+func checkRole(role string) (string, error) {
+	switch role {
+	case "":
+		return RoleRead, nil
+	case RoleRead, RoleAdmin:
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown role:%s", role)
+}
+
+func (a *authenticator) enabled() bool {
+	return len(a.tokens) != 0 || len(a.users) != 0
+}
+
+//返回请求的角色，认证失败时返回空字符串
+func (a *authenticator) role(r *http.Request) string {
+	if !a.enabled() {
+		return RoleAdmin
+	}
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return a.tokenRole(strings.TrimSpace(header[len("Bearer "):]))
+	}
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		//cookie会随跨站请求发送，只用于查询，修改操作必须通过请求头认证
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return ""
+		}
+		if token := r.URL.Query().Get(tokenParam); len(token) != 0 {
+			return a.tokenRole(token)
+		}
+		if cookie, err := r.Cookie(tokenCookie); err == nil {
+			return a.tokenRole(cookie.Value)
+		}
+		return ""
+	}
+	user, ok := a.users[name]
+	if !ok {
+		return ""
+	}
+	key := sha256.Sum256([]byte(user.PasswordHash + "\x00" + password))
+	a.lock.Lock()
+	cached := a.cache[key]
+	a.lock.Unlock()
+	if !cached {
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+			return ""
+		}
+		a.lock.Lock()
+		a.cache[key] = true
+		a.lock.Unlock()
+	}
+	return user.Role
+}
+
+//返回token的角色，token不存在时返回空字符串
+func (a *authenticator) tokenRole(token string) string {
+	role := ""
+	//逐个比较，避免通过响应时间猜测token
+	for key, value := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			role = value
+		}
+	}
+	return role
+}
+
+//查询只需要只读角色，POST等修改操作需要管理员角色
+func (a *authenticator) authorize(w http.ResponseWriter, r *http.Request) bool {
+	role := a.role(r)
+	if role == "" {
+		if len(a.users) != 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="go-auto-sftp", charset="UTF-8"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && role != RoleAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"conf"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticator_Authorize(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	auth, err := newAuthenticator(&conf.WebConfig{
+		Tokens: []*conf.TokenConfig{{Name: "ci", Token: "admin-token", Role: RoleAdmin}, {Name: "grafana", Token: "read-token"}},
+		Users:  []*conf.UserConfig{{User: "dev", PasswordHash: string(hash)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		method string
+		token  string
+		user   string
+		passwd string
+		expect int
+	}{
+		{http.MethodGet, "", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "wrong", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "read-token", "", "", http.StatusOK},
+		{http.MethodPost, "read-token", "", "", http.StatusForbidden},
+		{http.MethodPost, "admin-token", "", "", http.StatusOK},
+		{http.MethodGet, "", "dev", "secret", http.StatusOK},
+		{http.MethodGet, "", "dev", "secret", http.StatusOK}, //缓存
+		{http.MethodGet, "", "dev", "wrong", http.StatusUnauthorized},
+		{http.MethodPost, "", "dev", "secret", http.StatusForbidden},
+	}
+	for i, c := range cases {
+		r := httptest.NewRequest(c.method, "/api/v1/projects", nil)
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if c.user != "" {
+			r.SetBasicAuth(c.user, c.passwd)
+		}
+		w := httptest.NewRecorder()
+		code := http.StatusOK
+		if !auth.authorize(w, r) {
+			code = w.Code
+		}
+		if code != c.expect {
+			t.Errorf("case %d: status %d, expect %d", i, code, c.expect)
+		}
+	}
+
+	//查询参数和cookie中的token只用于查询
+	query := []struct {
+		method string
+		param  string
+		cookie string
+		expect int
+	}{
+		{http.MethodGet, "read-token", "", http.StatusOK},
+		{http.MethodGet, "wrong", "", http.StatusUnauthorized},
+		{http.MethodGet, "", "admin-token", http.StatusOK},
+		{http.MethodGet, "", "wrong", http.StatusUnauthorized},
+		{http.MethodPost, "admin-token", "", http.StatusUnauthorized},
+		{http.MethodPost, "", "admin-token", http.StatusUnauthorized},
+	}
+	for i, c := range query {
+		r := httptest.NewRequest(c.method, "/api/v1/events?token="+c.param, nil)
+		if c.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: tokenCookie, Value: c.cookie})
+		}
+		w := httptest.NewRecorder()
+		code := http.StatusOK
+		if !auth.authorize(w, r) {
+			code = w.Code
+		}
+		if code != c.expect {
+			t.Errorf("query case %d: status %d, expect %d", i, code, c.expect)
+		}
+	}
+
+	if _, err := newAuthenticator(&conf.WebConfig{Users: []*conf.UserConfig{{User: "dev", PasswordHash: "plain"}}}); err == nil {
+		t.Errorf("plain password should be rejected")
+	}
+	if _, err := newAuthenticator(&conf.WebConfig{Tokens: []*conf.TokenConfig{{Token: "x", Role: "root"}}}); err == nil {
+		t.Errorf("unknown role should be rejected")
+	}
+}
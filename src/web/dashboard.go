@@ -0,0 +1,278 @@
+package web
+
+//监控页面，所有样式和脚本内嵌，离线可用，数据来自JSON API
+//注意：原始字符串中不能出现反引号
+const dashboardHtml = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go-auto-sftp</title>
+<style>
+body{font-family:Helvetica,Arial,sans-serif;margin:0;background:#f4f5f7;color:#222;font-size:14px}
+header{background:#2d3e50;color:#fff;padding:10px 20px;font-size:18px}
+header span{font-size:12px;color:#bbb;margin-left:10px}
+main{padding:15px 20px}
+.project{background:#fff;border-radius:4px;box-shadow:0 1px 2px rgba(0,0,0,.15);margin-bottom:15px;padding:12px 15px}
+.project h2{margin:0 0 8px 0;font-size:16px}
+.state{display:inline-block;padding:1px 8px;border-radius:10px;font-size:12px;color:#fff;margin-left:8px;vertical-align:middle}
+.state.running{background:#2e9d4f}.state.paused{background:#d08a12}.state.stopped{background:#888}
+.meta{color:#555;font-size:12px;line-height:1.7}
+.error{color:#c0392b}
+button{margin-right:6px;padding:3px 10px;cursor:pointer}
+.section{margin-top:10px}
+.section>summary{cursor:pointer;font-weight:bold}
+.tree{font-family:Consolas,monospace;font-size:13px;margin:6px 0 0 0}
+.tree details{margin-left:16px}
+.tree .file{margin-left:32px}
+.tree summary{cursor:pointer}
+.NotModify{color:#555}.Modify{color:#d08a12}.Add{color:#2e9d4f}.Delete,.ShiftDelete{color:#c0392b;text-decoration:line-through}
+.legend span{margin-right:12px}
+table{border-collapse:collapse;width:100%;font-size:12px;margin-top:6px}
+th,td{border-bottom:1px solid #e3e3e3;text-align:left;padding:3px 6px;vertical-align:top}
+td.paths{font-family:Consolas,monospace;word-break:break-all;white-space:pre-line}
+</style>
+</head>
+<body>
+<header>go-auto-sftp<span id="updated"></span></header>
+<main>
+<div class="legend meta">
+<span class="NotModify">&#9632; NotModify</span><span class="Modify">&#9632; Modify</span><span class="Add">&#9632; Add</span><span class="Delete">&#9632; Delete</span>
+</div>
+<div id="projects"></div>
+</main>
+<script>
+var api = "api/v1/projects";
+var opened = {};   //展开的区域和目录，刷新后保持
+var live = {};     //事件流中最近的上传进度
+var diffs = {};    //最近一次比较的结果，比较需要遍历远程目录，定时刷新时不重新请求
+//通过?token=打开页面时，查询和事件流使用服务端设置的cookie，修改操作通过请求头传递token
+var token = sessionStorage.getItem("token");
+(function() {
+	var m = /[?&]token=([^&]*)/.exec(location.search);
+	if (m) {
+		token = decodeURIComponent(m[1]);
+		sessionStorage.setItem("token", token);
+		history.replaceState(null, "", location.pathname);
+	}
+})();
+
+function el(tag, cls, text) {
+	var e = document.createElement(tag);
+	if (cls) e.className = cls;
+	if (text !== undefined) e.textContent = text;
+	return e;
+}
+
+function get(url, fn) {
+	var xhr = new XMLHttpRequest();
+	xhr.open("GET", url);
+	xhr.onload = function() {
+		try { fn(JSON.parse(xhr.responseText)); } catch (e) { fn({error: xhr.responseText}); }
+	};
+	xhr.send();
+}
+
+function post(url) {
+	var xhr = new XMLHttpRequest();
+	xhr.open("POST", url);
+	if (token) xhr.setRequestHeader("Authorization", "Bearer " + token);
+	xhr.onload = function() {
+		var res = {};
+		try { res = JSON.parse(xhr.responseText); } catch (e) {}
+		if (res.error) alert(res.error);
+		setTimeout(refresh, 500);
+	};
+	xhr.send();
+}
+
+function time(t) {
+	if (!t || t.indexOf("0001-") === 0) return "-";
+	return new Date(t).toLocaleString();
+}
+
+function size(n) {
+	var units = ["B", "KB", "MB", "GB", "TB"];
+	var i = 0;
+	n = n || 0;
+	while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+	return (i === 0 ? n : n.toFixed(1)) + units[i];
+}
+
+function treeNode(name, node) {
+	if (node.type === "file") {
+		var f = el("div", "file " + node.status, node.name);
+		f.title = node.status + "  " + size(node.size) + "  " + time(node.modify_time);
+		return f;
+	}
+	var d = el("details");
+	var s = el("summary", node.status, node.name + "/");
+	s.title = node.status + "  " + time(node.modify_time);
+	d.appendChild(s);
+	var key = name + ":" + node.path;
+	d.open = key in opened ? opened[key] : (!node.path || node.status !== "NotModify");
+	d.addEventListener("toggle", function() { opened[key] = d.open; });
+	(node.children || []).forEach(function(child) {
+		d.appendChild(treeNode(name, child));
+	});
+	return d;
+}
+
+function loadTree(name, box) {
+	get(api + "/" + encodeURIComponent(name) + "/tree", function(res) {
+		box.innerHTML = "";
+		if (res.error) { box.appendChild(el("div", "error", res.error)); return; }
+		box.appendChild(treeNode(name, res));
+	});
+}
+
+function loadHistory(name, box) {
+	get(api + "/" + encodeURIComponent(name) + "/history", function(res) {
+		box.innerHTML = "";
+		if (res.error) { box.appendChild(el("div", "error", res.error)); return; }
+		if (!res.length) { box.appendChild(el("div", "meta", "no transfers")); return; }
+		var table = el("table");
+		var head = el("tr");
+		["time", "duration", "result", "paths"].forEach(function(h) { head.appendChild(el("th", "", h)); });
+		table.appendChild(head);
+		res.forEach(function(t) {
+			var tr = el("tr");
+			tr.appendChild(el("td", "", time(t.time)));
+			tr.appendChild(el("td", "", t.duration_ms + "ms"));
+			tr.appendChild(el("td", t.error ? "error" : "", t.error ? t.error : "ok"));
+			var paths = (t.paths && t.paths.length) ? t.paths : (t.dirs || []);
+			tr.appendChild(el("td", "paths", paths.join("\n") || "-"));
+			table.appendChild(tr);
+		});
+		box.appendChild(table);
+	});
+}
+
+function loadDiff(name, box, reload) {
+	var url = api + "/" + encodeURIComponent(name) + "/diff";
+	if (!reload && diffs[name]) { showDiff(name, box, url, diffs[name]); return; }
+	box.innerHTML = "";
+	box.appendChild(el("div", "meta", "comparing with remote..."));
+	get(url, function(res) {
+		diffs[name] = res;
+		showDiff(name, box, url, res);
+	});
+}
+
+function showDiff(name, box, url, res) {
+	box.innerHTML = "";
+	if (res.error) { box.appendChild(el("div", "error", res.error)); return; }
+	box.appendChild(el("div", "meta", "remote: " + res.remote));
+	if (!res.entries.length) { box.appendChild(el("div", "meta", "no differences")); return; }
+	var table = el("table");
+	var head = el("tr");
+	["path", "diff", "local", "remote"].forEach(function(h) { head.appendChild(el("th", "", h)); });
+	table.appendChild(head);
+	res.entries.forEach(function(d) {
+		var tr = el("tr");
+		tr.appendChild(el("td", "paths", d.path + (d.type === "dir" ? "/" : "")));
+		tr.appendChild(el("td", d.diff === "extra" ? "error" : "", d.diff));
+		tr.appendChild(el("td", "", d.diff === "extra" ? "-" : size(d.local_size) + "  " + time(d.local_time)));
+		tr.appendChild(el("td", "", d.diff === "missing" ? "-" : size(d.remote_size) + "  " + time(d.remote_time)));
+		table.appendChild(tr);
+	});
+	box.appendChild(table);
+	var actions = el("div", "section");
+	var sync = el("button", "", "sync differences");
+	sync.onclick = function() { delete diffs[name]; post(url); };
+	actions.appendChild(sync);
+	var del = el("button", "", "sync and delete extra");
+	del.onclick = function() {
+		if (!confirm("delete extra remote files of " + name + "?")) return;
+		delete diffs[name];
+		post(url + "?delete=1");
+	};
+	actions.appendChild(del);
+	box.appendChild(actions);
+}
+
+function section(name, title, load) {
+	var key = name + "/" + title;
+	var d = el("details", "section");
+	d.appendChild(el("summary", "", title));
+	var box = el("div", title === "tree" ? "tree" : "");
+	d.appendChild(box);
+	d.open = !!opened[key];
+	d.addEventListener("toggle", function() {
+		opened[key] = d.open;
+		if (d.open) load(name, box, true);
+	});
+	if (d.open) load(name, box);
+	return d;
+}
+
+function render(p) {
+	var div = el("div", "project");
+	var h = el("h2", "", p.name);
+	h.appendChild(el("span", "state " + p.state, p.state));
+	div.appendChild(h);
+	var meta = el("div", "meta");
+	meta.appendChild(el("div", "", p.local_base_dir + "  ->  " + p.remote_address + ":" + p.remote_base_dir + "  (" + p.mode + ")"));
+	meta.appendChild(el("div", "", "last scan: " + time(p.last_scan) + "    last sync: " + time(p.last_sync)));
+	if (p.pending && p.pending.length) meta.appendChild(el("div", "", "pending: " + p.pending.join(", ")));
+	if (p.failed && p.failed.length) meta.appendChild(el("div", "error", "failed: " + p.failed.join(", ")));
+	if (live[p.name]) meta.appendChild(el("div", "", live[p.name]));
+	if (p.last_error) meta.appendChild(el("div", "error", "last error (" + time(p.last_error_time) + "): " + p.last_error));
+	div.appendChild(meta);
+	var actions = el("div", "section");
+	var buttons = ["sync", p.state === "paused" ? "resume" : "pause"];
+	if (p.failed && p.failed.length) buttons.push("retry");
+	buttons.forEach(function(action) {
+		var b = el("button", "", action);
+		b.onclick = function() { post(api + "/" + encodeURIComponent(p.name) + "/" + action); };
+		actions.appendChild(b);
+	});
+	div.appendChild(actions);
+	div.appendChild(section(p.name, "tree", loadTree));
+	div.appendChild(section(p.name, "history", loadHistory));
+	div.appendChild(section(p.name, "diff", loadDiff));
+	return div;
+}
+
+function refresh() {
+	get(api, function(res) {
+		var box = document.getElementById("projects");
+		box.innerHTML = "";
+		if (res.error) { box.appendChild(el("div", "error", res.error)); return; }
+		res.forEach(function(p) { box.appendChild(render(p)); });
+		document.getElementById("updated").textContent = "updated " + new Date().toLocaleTimeString();
+	});
+}
+
+var timer = null;
+function refreshSoon() {
+	if (timer) return;
+	timer = setTimeout(function() { timer = null; refresh(); }, 1000);
+}
+
+//有事件流时实时刷新，否则定时轮询
+if (window.EventSource) {
+	var source = new EventSource("api/v1/events");
+	["scan_finished", "change_detected", "upload_completed", "upload_failed", "connection_lost", "connection_restored"].forEach(function(type) {
+		source.addEventListener(type, function(msg) {
+			var e = JSON.parse(msg.data);
+			if (type === "upload_completed" || type === "upload_failed") delete live[e.project];
+			if (type === "scan_finished" && !(e.dirs && e.dirs.length)) return;
+			refreshSoon();
+		});
+	});
+	["upload_started", "upload_progress"].forEach(function(type) {
+		source.addEventListener(type, function(msg) {
+			var e = JSON.parse(msg.data);
+			var text = "uploading: " + e.path;
+			if (e.total) text += "  " + size(e.bytes) + " / " + size(e.total) + " (" + Math.floor(e.bytes * 100 / e.total) + "%)";
+			live[e.project] = text;
+			refreshSoon();
+		});
+	});
+}
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"encoding/json"
+	"event"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"web/resource"
+	"web/router"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+//事件流：GET api/v1/events?project=名称&type=类型1,类型2
+//以Server-Sent Events推送，project、type为空时不过滤
+func (h *HttpServerHandle) serveEvents(w http.ResponseWriter, r *http.Request, params router.Params) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	name := r.URL.Query().Get("project")
+	if _, ok := h.projects.Get(name); name != "" && !ok {
+		writeResponse(w, resource.JsonError(http.StatusNotFound, fmt.Sprintf("project %s not found", name)))
+		return
+	}
+	types := make(map[string]bool)
+	for _, typ := range strings.Split(r.URL.Query().Get("type"), ",") {
+		if typ != "" {
+			types[typ] = true
+		}
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	subscriber := event.Subscribe(name)
+	defer event.Unsubscribe(subscriber)
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e := <-subscriber.C:
+			if len(types) > 0 && !types[e.Type] {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,347 @@
+package resource
+
+import (
+	"dir"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"journal"
+	"net/http"
+	"net/url"
+	"os"
+	"project"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//JSON API的路径前缀
+const ApiPrefix = "api/v1"
+
+//项目支持的操作
+const (
+	ActionSync   = "sync"
+	ActionPause  = "pause"
+	ActionResume = "resume"
+	ActionRetry  = "retry"
+)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type apiResult struct {
+	Result string `json:"result"`
+}
+
+func toJson(v interface{}) string {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return toJson(apiError{Error: err.Error()})
+	}
+	return string(content)
+}
+
+func jsonResponse(status int, v interface{}) *Response {
+	return &Response{
+		Status:      status,
+		ContentType: ContentJson,
+		Body:        toJson(v),
+	}
+}
+
+func JsonError(status int, msg string) *Response {
+	return jsonResponse(status, apiError{Error: msg})
+}
+
+//根据路径参数name查找项目
+func lookupProject(projects *project.Projects, req *Request) (*project.Project, *Response) {
+	name := req.Params["name"]
+	p, ok := projects.Get(name)
+	if !ok {
+		return nil, JsonError(http.StatusNotFound, fmt.Sprintf("project %s not found", name))
+	}
+	return p, nil
+}
+
+//项目列表：GET api/v1/projects
+type ProjectListResource struct {
+	Projects *project.Projects
+}
+
+func NewProjectListResource(projects *project.Projects) *ProjectListResource {
+	return &ProjectListResource{
+		Projects: projects,
+	}
+}
+
+func (r *ProjectListResource) Get(req *Request) *Response {
+	projects := r.Projects.List()
+	list := make([]project.Status, 0, len(projects))
+	for _, p := range projects {
+		list = append(list, p.Status())
+	}
+	return jsonResponse(http.StatusOK, list)
+}
+
+//项目状态：GET api/v1/projects/{name}
+type ProjectResource struct {
+	Projects *project.Projects
+}
+
+func NewProjectResource(projects *project.Projects) *ProjectResource {
+	return &ProjectResource{
+		Projects: projects,
+	}
+}
+
+func (r *ProjectResource) Get(req *Request) *Response {
+	p, res := lookupProject(r.Projects, req)
+	if res != nil {
+		return res
+	}
+	return jsonResponse(http.StatusOK, p.Status())
+}
+
+//项目操作：POST api/v1/projects/{name}/{action}，action为sync、pause、resume、retry
+type ProjectActionResource struct {
+	Projects *project.Projects
+}
+
+func NewProjectActionResource(projects *project.Projects) *ProjectActionResource {
+	return &ProjectActionResource{
+		Projects: projects,
+	}
+}
+
+func (r *ProjectActionResource) Post(req *Request) *Response {
+	p, res := lookupProject(r.Projects, req)
+	if res != nil {
+		return res
+	}
+	switch action := req.Params["action"]; action {
+	case ActionSync:
+		p.Sync()
+	case ActionPause:
+		p.Pause()
+	case ActionResume:
+		p.Resume()
+	case ActionRetry:
+		if err := p.Retry(); err != nil {
+			return JsonError(http.StatusConflict, err.Error())
+		}
+	default:
+		return JsonError(http.StatusNotFound, fmt.Sprint("unknown action:", action))
+	}
+	return jsonResponse(http.StatusOK, apiResult{Result: "ok"})
+}
+
+//目录树：GET api/v1/projects/{name}/tree/*path，path相对项目基目录，也可以通过查询参数path指定
+//支持的查询参数见TreeOptions，默认输出json
+type ProjectTreeResource struct {
+	Projects *project.Projects
+}
+
+func NewProjectTreeResource(projects *project.Projects) *ProjectTreeResource {
+	return &ProjectTreeResource{
+		Projects: projects,
+	}
+}
+
+func (r *ProjectTreeResource) Get(req *Request) *Response {
+	p, res := lookupProject(r.Projects, req)
+	if res != nil {
+		return res
+	}
+	path := req.Params["path"]
+	if len(path) == 0 {
+		path = req.Query.Get("path")
+	}
+	path = strings.Trim(path, "/")
+	options, err := ParseTreeOptions(req.Query, FormatJson)
+	if err != nil {
+		return JsonError(http.StatusBadRequest, err.Error())
+	}
+	p.ReadDirs(func(dirs *dir.Directory) {
+		absPath := dirs.Dir.DirName
+		if len(path) != 0 {
+			absPath = fmt.Sprintf("%s%c%s", absPath, os.PathSeparator, strings.Join(strings.Split(path, "/"), string(os.PathSeparator)))
+		}
+		d, ok := dirs.DirMap[absPath]
+		if !ok {
+			res = JsonError(http.StatusNotFound, fmt.Sprintf("path %s not found", path))
+			return
+		}
+		res = renderTree(d, path, options)
+	})
+	return res
+}
+
+//传输记录：GET api/v1/projects/{name}/history
+type ProjectHistoryResource struct {
+	Projects *project.Projects
+}
+
+func NewProjectHistoryResource(projects *project.Projects) *ProjectHistoryResource {
+	return &ProjectHistoryResource{
+		Projects: projects,
+	}
+}
+
+func (r *ProjectHistoryResource) Get(req *Request) *Response {
+	p, res := lookupProject(r.Projects, req)
+	if res != nil {
+		return res
+	}
+	return jsonResponse(http.StatusOK, p.History())
+}
+
+//路径包含..时返回400，远程或本地路径不存在时返回404，其他远程错误返回502
+func remoteError(err error) *Response {
+	if errors.Is(err, project.ErrInvalidPath) {
+		return JsonError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return JsonError(http.StatusNotFound, err.Error())
+	}
+	return JsonError(http.StatusBadGateway, err.Error())
+}
+
+type remoteList struct {
+	Remote  string                 `json:"remote"`
+	Entries []*project.RemoteEntry `json:"entries"`
+}
+
+//远程目录：GET api/v1/projects/{name}/remote/*path，path为本地相对项目基目录的路径，按映射规则转换为远程路径
+type ProjectRemoteResource struct {
+	Projects *project.Projects
+}
+
+func NewProjectRemoteResource(projects *project.Projects) *ProjectRemoteResource {
+	return &ProjectRemoteResource{
+		Projects: projects,
+	}
+}
+
+func (r *ProjectRemoteResource) Get(req *Request) *Response {
+	p, res := lookupProject(r.Projects, req)
+	if res != nil {
+		return res
+	}
+	remote, entries, err := p.RemoteDir(req.Params["path"])
+	if errors.Is(err, project.ErrInvalidPath) {
+		return remoteError(err)
+	}
+	if err != nil {
+		return remoteError(fmt.Errorf("read remote dir %s failed: %w", remote, err))
+	}
+	return jsonResponse(http.StatusOK, remoteList{Remote: remote, Entries: entries})
+}
+
+//本地与远程的差异：GET api/v1/projects/{name}/diff/*path?depth=N，depth默认不限制
+//同步差异：POST api/v1/projects/{name}/diff/*path?delete=1，delete为1时删除远程多余的文件
+type ProjectDiffResource struct {
+	Projects *project.Projects
+}
+
+func NewProjectDiffResource(projects *project.Projects) *ProjectDiffResource {
+	return &ProjectDiffResource{
+		Projects: projects,
+	}
+}
+
+func (r *ProjectDiffResource) Get(req *Request) *Response {
+	p, res := lookupProject(r.Projects, req)
+	if res != nil {
+		return res
+	}
+	depth := -1
+	if v := req.Query.Get("depth"); len(v) != 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return JsonError(http.StatusBadRequest, fmt.Sprint("invalid depth:", v))
+		}
+		depth = n
+	}
+	diff, err := p.Diff(req.Params["path"], depth)
+	if err != nil {
+		return remoteError(err)
+	}
+	return jsonResponse(http.StatusOK, diff)
+}
+
+func (r *ProjectDiffResource) Post(req *Request) *Response {
+	p, res := lookupProject(r.Projects, req)
+	if res != nil {
+		return res
+	}
+	deleteExtra := false
+	if v := req.Query.Get("delete"); len(v) != 0 {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return JsonError(http.StatusBadRequest, fmt.Sprint("invalid delete:", v))
+		}
+		deleteExtra = b
+	}
+	diff, err := p.SyncDiff(req.Params["path"], deleteExtra)
+	if err != nil {
+		return remoteError(err)
+	}
+	return jsonResponse(http.StatusOK, diff)
+}
+
+const defaultJournalLimit = 200
+
+//解析传输日志的查询参数：since、until（时间或相对时长如1h）、path、op、result、cycle、limit
+func ParseJournalFilter(query url.Values, now time.Time) (journal.Filter, error) {
+	filter := journal.Filter{
+		Path:   query.Get("path"),
+		Op:     query.Get("op"),
+		Result: query.Get("result"),
+		Cycle:  query.Get("cycle"),
+		Limit:  defaultJournalLimit,
+	}
+	var err error
+	if filter.Since, err = journal.ParseTime(query.Get("since"), now); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = journal.ParseTime(query.Get("until"), now); err != nil {
+		return filter, err
+	}
+	if v := query.Get("limit"); len(v) != 0 {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			return filter, fmt.Errorf("invalid limit:%s", v)
+		}
+	}
+	return filter, nil
+}
+
+//传输日志：GET api/v1/projects/{name}/journal，最新的在前，默认最多返回200条，limit=0不限制
+type ProjectJournalResource struct {
+	Projects *project.Projects
+}
+
+func NewProjectJournalResource(projects *project.Projects) *ProjectJournalResource {
+	return &ProjectJournalResource{
+		Projects: projects,
+	}
+}
+
+func (r *ProjectJournalResource) Get(req *Request) *Response {
+	p, res := lookupProject(r.Projects, req)
+	if res != nil {
+		return res
+	}
+	filter, err := ParseJournalFilter(req.Query, time.Now())
+	if err != nil {
+		return JsonError(http.StatusBadRequest, err.Error())
+	}
+	records, err := p.Journal(filter)
+	if err == project.ErrJournalDisabled {
+		return JsonError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return JsonError(http.StatusInternalServerError, err.Error())
+	}
+	return jsonResponse(http.StatusOK, records)
+}
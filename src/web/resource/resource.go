@@ -4,55 +4,82 @@ import (
 	"bytes"
 	"dir"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"project"
 	"strings"
 )
 
-type Resource interface {
-	Get(string) string
+const (
+	ContentText = "text/plain; charset=utf-8"
+	ContentJson = "application/json; charset=utf-8"
+)
+
+//已解码的请求参数
+type Request struct {
+	Params map[string]string //路径参数
+	Query  url.Values
+}
+
+type Response struct {
+	Status      int
+	ContentType string
+	Body        string
+}
+
+type Handler func(req *Request) *Response
+
+func text(status int, body string) *Response {
+	return &Response{
+		Status:      status,
+		ContentType: ContentText,
+		Body:        body,
+	}
 }
 
+//目录树：GET {name}?path=基目录名/子目录，支持的查询参数见TreeOptions，默认输出缩进文本
 type DirTreeResource struct {
-	Project *project.Project
+	Projects *project.Projects
 }
 
-func NewDirTreeResource(project *project.Project) Resource{
+func NewDirTreeResource(projects *project.Projects) *DirTreeResource{
 	return &DirTreeResource{
-		Project:project,
+		Projects:projects,
 	}
 }
 
-func (d *DirTreeResource) Get(path string) string {
-	buffer := new(bytes.Buffer)
-	format := func(n int) error {
-		if n == 0 {
-			return nil
-		}
-		for i:=0; i<n; i++ {
-			err := buffer.WriteByte('-')
-			if err != nil {
-				return err
-			}
-		}
-		err := buffer.WriteByte('>')
-		if err != nil {
-			return err
-		}
-		return nil
+func (d *DirTreeResource) Get(req *Request) *Response {
+	p, ok := d.Projects.Get(req.Params["name"])
+	if !ok {
+		return text(http.StatusNotFound, "Not Found")
 	}
-	osPath := strings.Join(strings.Split(path, "/"), fmt.Sprintf("%c", os.PathSeparator))
-	basePath := filepath.Dir(d.Project.Dirs.Dir.DirName)
-	obsPath := fmt.Sprintf("%s%c%s", basePath, os.PathSeparator, osPath)
-	if _, ok := d.Project.Dirs.DirMap[obsPath]; !ok {
-		return "Not Found"
+	path, ok := req.Query["path"]
+	if !ok || len(path) != 1 {
+		return text(http.StatusBadRequest, "Invalid url")
 	}
-	err := printDirTree(d.Project.Dirs.DirMap[obsPath], 0, format, buffer)
+	options, err := ParseTreeOptions(req.Query, FormatText)
 	if err != nil {
-		return "error"
+		return text(http.StatusBadRequest, err.Error())
 	}
-	return buffer.String()
+	var res *Response
+	p.ReadDirs(func(dirs *dir.Directory) {
+		osPath := strings.Join(strings.Split(path[0], "/"), fmt.Sprintf("%c", os.PathSeparator))
+		basePath := filepath.Dir(dirs.Dir.DirName)
+		obsPath := fmt.Sprintf("%s%c%s", basePath, os.PathSeparator, osPath)
+		if _, ok := dirs.DirMap[obsPath]; !ok {
+			res = text(http.StatusNotFound, "Not Found")
+			return
+		}
+		//输出中的路径相对项目基目录
+		rel, _ := filepath.Rel(dirs.Dir.DirName, obsPath)
+		if rel == "." {
+			rel = ""
+		}
+		res = renderTree(dirs.DirMap[obsPath], filepath.ToSlash(rel), options)
+	})
+	return res
 }
 
 func printDirTree(dir *dir.DirectoryStruct, n int, format func(n int) error, w *bytes.Buffer) error {
@@ -81,4 +108,24 @@ func printDirTree(dir *dir.DirectoryStruct, n int, format func(n int) error, w *
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+//触发项目立即检测并上传：POST {name}/sync
+type SyncResource struct {
+	Projects *project.Projects
+}
+
+func NewSyncResource(projects *project.Projects) *SyncResource{
+	return &SyncResource{
+		Projects:projects,
+	}
+}
+
+func (s *SyncResource) Post(req *Request) *Response {
+	p, ok := s.Projects.Get(req.Params["name"])
+	if !ok {
+		return text(http.StatusNotFound, "Not Found")
+	}
+	p.Sync()
+	return text(http.StatusOK, "OK")
+}
@@ -0,0 +1,313 @@
+package resource
+
+import (
+	"bytes"
+	"dir"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//目录树的输出格式
+const (
+	FormatText = "text" //缩进文本
+	FormatJson = "json"
+	FormatCsv  = "csv"
+	FormatTree = "tree" //类似tree命令的树形字符
+	FormatRaw  = "raw"  //旧版本的输出：-->名称:状态码，忽略其他参数
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+//目录树查询参数
+//  depth：最大深度，0只输出当前目录，默认不限制
+//  status：状态过滤，逗号分隔，如Add,Modify；pending表示Add、Modify、Delete
+//  name：文件名、目录名的通配符，如*.php
+//  sort：name、size、mtime、status，前缀-表示倒序，默认按目录结构中的顺序
+//  format：text、json、csv、tree、raw
+//目录本身不满足过滤条件、但子孙满足时保留，以便看到完整路径
+type TreeOptions struct {
+	Depth  int
+	Status map[string]bool
+	Name   string
+	Sort   string
+	Desc   bool
+	Format string
+}
+
+func ParseTreeOptions(query url.Values, defaultFormat string) (*TreeOptions, error) {
+	options := &TreeOptions{
+		Depth:  -1,
+		Format: defaultFormat,
+	}
+	if depth := query.Get("depth"); len(depth) != 0 {
+		n, err := strconv.Atoi(depth)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid depth:%s", depth)
+		}
+		options.Depth = n
+	}
+	if status := query.Get("status"); len(status) != 0 {
+		options.Status = make(map[string]bool)
+		for _, name := range strings.Split(status, ",") {
+			switch name = strings.TrimSpace(name); {
+			case strings.EqualFold(name, "pending"):
+				for _, s := range []int{dir.Add, dir.Modify, dir.Delete} {
+					options.Status[dir.StatusName(s)] = true
+				}
+			case statusByName(name) != "":
+				options.Status[statusByName(name)] = true
+			default:
+				return nil, fmt.Errorf("invalid status:%s", name)
+			}
+		}
+	}
+	if name := query.Get("name"); len(name) != 0 {
+		if _, err := filepath.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern:%s", name)
+		}
+		options.Name = name
+	}
+	if sortBy := query.Get("sort"); len(sortBy) != 0 {
+		options.Desc = strings.HasPrefix(sortBy, "-")
+		options.Sort = strings.TrimPrefix(sortBy, "-")
+		switch options.Sort {
+		case "name", "size", "mtime", "status":
+		default:
+			return nil, fmt.Errorf("invalid sort:%s", sortBy)
+		}
+	}
+	if format := query.Get("format"); len(format) != 0 {
+		switch format {
+		case FormatText, FormatJson, FormatCsv, FormatTree, FormatRaw:
+			options.Format = format
+		default:
+			return nil, fmt.Errorf("invalid format:%s", format)
+		}
+	}
+	return options, nil
+}
+
+//状态名不区分大小写，返回规范的名称
+func statusByName(name string) string {
+	for _, s := range []int{dir.NotModify, dir.Modify, dir.Add, dir.Delete} {
+		if strings.EqualFold(dir.StatusName(s), name) {
+			return dir.StatusName(s)
+		}
+	}
+	return ""
+}
+
+type TreeNode struct {
+	Name       string      `json:"name"`
+	Path       string      `json:"path"` //相对项目基目录，以/分隔
+	Type       string      `json:"type"` //dir、file
+	Status     string      `json:"status"`
+	Size       int64       `json:"size,omitempty"`
+	ModifyTime time.Time   `json:"modify_time"`
+	Truncated  bool        `json:"truncated,omitempty"` //超过最大深度，有满足过滤条件的子孙未输出
+	Children   []*TreeNode `json:"children,omitempty"`
+}
+
+func (o *TreeOptions) match(name, status string) bool {
+	if o.Status != nil && !o.Status[status] {
+		return false
+	}
+	if len(o.Name) != 0 {
+		if ok, _ := filepath.Match(o.Name, name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+//按查询参数生成目录树，depth为当前节点的深度，不满足过滤条件且没有满足条件的子孙时返回nil
+func buildTree(d *dir.DirectoryStruct, path string, options *TreeOptions, depth int) *TreeNode {
+	node := &TreeNode{
+		Name:       filepath.Base(d.DirName),
+		Path:       path,
+		Type:       "dir",
+		Status:     dir.StatusName(d.Status),
+		ModifyTime: d.ModifyTime,
+	}
+	if options.Depth >= 0 && depth >= options.Depth {
+		node.Truncated = options.matchDescendant(d)
+	}else{
+		node.Children = make([]*TreeNode, 0, len(d.DirChild)+len(d.File))
+		for _, child := range d.DirChild {
+			if n := buildTree(child, joinPath(path, filepath.Base(child.DirName)), options, depth+1); n != nil {
+				node.Children = append(node.Children, n)
+			}
+		}
+		for _, file := range d.File {
+			name := filepath.Base(file.Name)
+			status := dir.StatusName(file.Status)
+			if !options.match(name, status) {
+				continue
+			}
+			node.Children = append(node.Children, &TreeNode{
+				Name:       name,
+				Path:       joinPath(path, name),
+				Type:       "file",
+				Status:     status,
+				Size:       file.Size,
+				ModifyTime: file.ModifyTime,
+			})
+		}
+		sortTree(node.Children, options)
+	}
+	if depth != 0 && len(node.Children) == 0 && !node.Truncated && !options.match(node.Name, node.Status) {
+		return nil
+	}
+	return node
+}
+
+//目录下是否有满足过滤条件的子孙，没有过滤条件时即是否有子孙
+func (o *TreeOptions) matchDescendant(d *dir.DirectoryStruct) bool {
+	for _, child := range d.DirChild {
+		if o.match(filepath.Base(child.DirName), dir.StatusName(child.Status)) || o.matchDescendant(child) {
+			return true
+		}
+	}
+	for _, file := range d.File {
+		if o.match(filepath.Base(file.Name), dir.StatusName(file.Status)) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortTree(nodes []*TreeNode, options *TreeOptions) {
+	var less func(a, b *TreeNode) bool
+	switch options.Sort {
+	case "name":
+		less = func(a, b *TreeNode) bool { return a.Name < b.Name }
+	case "size":
+		less = func(a, b *TreeNode) bool { return a.Size < b.Size }
+	case "mtime":
+		less = func(a, b *TreeNode) bool { return a.ModifyTime.Before(b.ModifyTime) }
+	case "status":
+		less = func(a, b *TreeNode) bool { return a.Status < b.Status }
+	default:
+		return
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if options.Desc {
+			return less(nodes[j], nodes[i])
+		}
+		return less(nodes[i], nodes[j])
+	})
+}
+
+func joinPath(parent, name string) string {
+	if len(parent) == 0 {
+		return name
+	}
+	return parent + "/" + name
+}
+
+//按格式输出目录树
+func renderTree(d *dir.DirectoryStruct, path string, options *TreeOptions) *Response {
+	if options.Format == FormatRaw {
+		buffer := new(bytes.Buffer)
+		if err := printDirTree(d, 0, rawIndent(buffer), buffer); err != nil {
+			return text(http.StatusInternalServerError, "error")
+		}
+		return text(http.StatusOK, buffer.String())
+	}
+	root := buildTree(d, path, options, 0)
+	buffer := new(bytes.Buffer)
+	switch options.Format {
+	case FormatJson:
+		return jsonResponse(http.StatusOK, root)
+	case FormatCsv:
+		w := csv.NewWriter(buffer)
+		w.Write([]string{"path", "type", "status", "size", "modify_time"})
+		writeCsv(w, root)
+		w.Flush()
+		return &Response{Status: http.StatusOK, ContentType: "text/csv; charset=utf-8", Body: buffer.String()}
+	case FormatTree:
+		buffer.WriteString(nodeLine(root) + "\n")
+		writeTree(buffer, root.Children, "")
+	default:
+		writeText(buffer, root, 0)
+	}
+	return text(http.StatusOK, buffer.String())
+}
+
+func rawIndent(buffer *bytes.Buffer) func(n int) error {
+	return func(n int) error {
+		if n == 0 {
+			return nil
+		}
+		buffer.WriteString(strings.Repeat("-", n))
+		return buffer.WriteByte('>')
+	}
+}
+
+//名称 [状态] 大小 修改时间，目录名以/结尾
+func nodeLine(node *TreeNode) string {
+	line := fmt.Sprintf("%s [%s]", node.Name, node.Status)
+	if node.Type == "dir" {
+		line = fmt.Sprintf("%s/ [%s]", node.Name, node.Status)
+	}else{
+		line += " " + HumanSize(node.Size)
+	}
+	if !node.ModifyTime.IsZero() {
+		line += " " + node.ModifyTime.Format(timeLayout)
+	}
+	if node.Truncated {
+		line += " ..."
+	}
+	return line
+}
+
+func writeText(buffer *bytes.Buffer, node *TreeNode, depth int) {
+	buffer.WriteString(strings.Repeat("  ", depth) + nodeLine(node) + "\n")
+	for _, child := range node.Children {
+		writeText(buffer, child, depth+1)
+	}
+}
+
+func writeTree(buffer *bytes.Buffer, nodes []*TreeNode, prefix string) {
+	for i, node := range nodes {
+		branch, next := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, next = "└── ", "    "
+		}
+		buffer.WriteString(prefix + branch + nodeLine(node) + "\n")
+		writeTree(buffer, node.Children, prefix+next)
+	}
+}
+
+func writeCsv(w *csv.Writer, node *TreeNode) {
+	modifyTime := ""
+	if !node.ModifyTime.IsZero() {
+		modifyTime = node.ModifyTime.Format(time.RFC3339)
+	}
+	w.Write([]string{node.Path, node.Type, node.Status, strconv.FormatInt(node.Size, 10), modifyTime})
+	for _, child := range node.Children {
+		writeCsv(w, child)
+	}
+}
+
+//以1024为进制的可读大小，如1.5KB
+func HumanSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%s", size, units[i])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[i])
+}
@@ -0,0 +1,97 @@
+package resource
+
+import (
+	"dir"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTree(t *testing.T) *dir.Directory {
+	base := t.TempDir()
+	os.MkdirAll(filepath.Join(base, "src", "lib"), 0777)
+	ioutil.WriteFile(filepath.Join(base, "src", "main.php"), []byte("<?php"), 0666)
+	ioutil.WriteFile(filepath.Join(base, "src", "lib", "util.php"), make([]byte, 2048), 0666)
+	ioutil.WriteFile(filepath.Join(base, "readme.md"), []byte("readme"), 0666)
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		return os.Chtimes(path, mtime, mtime)
+	})
+	dirs := dir.New()
+	if err := dirs.Open(base); err != nil {
+		t.Fatal(err)
+	}
+	//readme.md已同步，其他仍为Add
+	for _, d := range dirs.DirMap {
+		if d.DirName == base {
+			d.Status = dir.Modify
+			for _, f := range d.File {
+				f.Status = dir.NotModify
+			}
+		}
+	}
+	return dirs
+}
+
+func render(t *testing.T, dirs *dir.Directory, query string) string {
+	values, _ := url.ParseQuery(query)
+	options, err := ParseTreeOptions(values, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return renderTree(dirs.Dir, "", options).Body
+}
+
+func TestRenderTree(t *testing.T) {
+	dirs := testTree(t)
+	name := filepath.Base(dirs.Dir.DirName)
+
+	text := render(t, dirs, "sort=name")
+	expect := name + "/ [Modify]\n" + //根目录没有记录修改时间
+		"  readme.md [NotModify] 6B 2024-01-02 03:04:05\n" +
+		"  src/ [Add] 2024-01-02 03:04:05\n" +
+		"    lib/ [Add] 2024-01-02 03:04:05\n" +
+		"      util.php [Add] 2.0KB 2024-01-02 03:04:05\n" +
+		"    main.php [Add] 5B 2024-01-02 03:04:05\n"
+	if text != expect {
+		t.Errorf("text:\n%s\nexpect:\n%s", text, expect)
+	}
+
+	if text := render(t, dirs, "depth=1&sort=name"); !strings.Contains(text, "src/ [Add] 2024-01-02 03:04:05 ...\n") || strings.Contains(text, "lib") {
+		t.Errorf("depth limit not applied:\n%s", text)
+	}
+	//超过最大深度的目录本身不满足过滤条件，但有满足条件的子孙时保留并标记为截断
+	if text := render(t, dirs, "depth=1&name=util.php"); text != name+"/ [Modify]\n  src/ [Add] 2024-01-02 03:04:05 ...\n" {
+		t.Errorf("truncated directory with matching descendant:\n%s", text)
+	}
+	if text := render(t, dirs, "depth=1&name=none.txt"); text != name+"/ [Modify]\n" {
+		t.Errorf("truncated directory without matching descendant:\n%s", text)
+	}
+	if text := render(t, dirs, "status=pending&name=*.php&format=tree&sort=-name"); text != name+"/ [Modify]\n"+
+		"└── src/ [Add] 2024-01-02 03:04:05\n"+
+		"    ├── main.php [Add] 5B 2024-01-02 03:04:05\n"+
+		"    └── lib/ [Add] 2024-01-02 03:04:05\n"+
+		"        └── util.php [Add] 2.0KB 2024-01-02 03:04:05\n" {
+		t.Errorf("tree:\n%s", text)
+	}
+	csv := render(t, dirs, "format=csv&status=notmodify")
+	if lines := strings.Split(strings.TrimSpace(csv), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[2], "readme.md,file,NotModify,6,") {
+		t.Errorf("csv:\n%s", csv)
+	}
+	if raw := render(t, dirs, "format=raw"); !strings.Contains(raw, "-->readme.md:0\n") {
+		t.Errorf("raw:\n%s", raw)
+	}
+}
+
+func TestParseTreeOptions(t *testing.T) {
+	for _, query := range []string{"depth=-1", "depth=x", "status=Gone", "sort=owner", "format=xml", "name=["} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParseTreeOptions(values, FormatText); err == nil {
+			t.Errorf("%s should be rejected", query)
+		}
+	}
+}
@@ -1,31 +1,144 @@
 package router
 
 import (
-	"errors"
-	"web/resource"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 )
 
-var RouterTable Router = new(router)
+var RouterTable Router = New()
+
+//路径参数，*path形式的参数为剩余的全部路径（已解码，以/分隔）
+type Params map[string]string
+
+type Handle func(w http.ResponseWriter, r *http.Request, params Params)
 
 type Router interface {
-	Register(string, resource.Resource)
-	GetRouter(string) (resource.Resource, error)
+	//pattern以/分隔，{name}匹配一段路径，*name匹配剩余的全部路径（可以为空），只能出现在最后
+	//同一方法和pattern重复注册时替换原处理函数
+	Register(method, pattern string, handle Handle)
+	//返回匹配的处理函数和路径参数，路径不存在时status为404，方法不支持时为405并返回支持的方法
+	Lookup(method, path string) (handle Handle, params Params, status int, allow []string)
+}
+
+type route struct {
+	segments []string
+	handles  map[string]Handle
 }
 
 type router struct {
-	routerTable map[string]resource.Resource
+	lock   sync.RWMutex
+	routes []*route
+}
+
+func New() Router {
+	return new(router)
+}
+
+//path为转义后的路径（URL.EscapedPath），分段后再解码，路径中转义的/不会被当作分隔符
+func split(path string) []string {
+	path = strings.Trim(path, "/")
+	if len(path) == 0 {
+		return nil
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if unescaped, err := url.PathUnescape(seg); err == nil {
+			segments[i] = unescaped
+		}
+	}
+	return segments
+}
+
+func (r *router) Register(method, pattern string, handle Handle) {
+	segments := split(pattern)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, rt := range r.routes {
+		if strings.Join(rt.segments, "/") == strings.Join(segments, "/") {
+			rt.handles[method] = handle
+			return
+		}
+	}
+	r.routes = append(r.routes, &route{
+		segments: segments,
+		handles:  map[string]Handle{method: handle},
+	})
 }
 
-func (r *router) Register(project string, handle resource.Resource) {
-	if r.routerTable == nil {
-		r.routerTable = make(map[string]resource.Resource)
+func (r *router) Lookup(method, path string) (Handle, Params, int, []string) {
+	segments := split(path)
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var best *route
+	var bestParams Params
+	var bestScore []int
+	for _, rt := range r.routes {
+		params, score, ok := rt.match(segments)
+		if !ok {
+			continue
+		}
+		if best == nil || better(score, bestScore) {
+			best, bestParams, bestScore = rt, params, score
+		}
+	}
+	if best == nil {
+		return nil, nil, http.StatusNotFound, nil
 	}
-	r.routerTable[project] = handle
+	handle, ok := best.handles[method]
+	if !ok && method == http.MethodHead {
+		handle, ok = best.handles[http.MethodGet]
+	}
+	if !ok {
+		allow := make([]string, 0, len(best.handles))
+		for m := range best.handles {
+			allow = append(allow, m)
+		}
+		sort.Strings(allow)
+		return nil, nil, http.StatusMethodNotAllowed, allow
+	}
+	return handle, bestParams, http.StatusOK, nil
 }
 
-func (r *router) GetRouter(project string) (resource.Resource, error) {
-	 if _, ok := r.routerTable[project]; ok {
-	 	return r.routerTable[project], nil
-	 }
-	 return nil, errors.New("Not Found")
-}
\ No newline at end of file
+//匹配时每一段的得分：固定路径2，{name}为1，*name为0，得分高的优先
+func (rt *route) match(segments []string) (Params, []int, bool) {
+	params := make(Params)
+	score := make([]int, 0, len(rt.segments))
+	for i, seg := range rt.segments {
+		if strings.HasPrefix(seg, "*") {
+			rest := ""
+			if i < len(segments) {
+				rest = strings.Join(segments[i:], "/")
+			}
+			params[seg[1:]] = rest
+			return params, append(score, 0), true
+		}
+		if i >= len(segments) {
+			return nil, nil, false
+		}
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			params[seg[1:len(seg)-1]] = segments[i]
+			score = append(score, 1)
+			continue
+		}
+		if seg != segments[i] {
+			return nil, nil, false
+		}
+		score = append(score, 2)
+	}
+	if len(segments) != len(rt.segments) {
+		return nil, nil, false
+	}
+	return params, score, true
+}
+
+func better(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return len(a) > len(b)
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRouter_Lookup(t *testing.T) {
+	r := New()
+	names := make(map[string]string)
+	handle := func(name string) Handle {
+		names[name] = name
+		return func(w http.ResponseWriter, req *http.Request, params Params) {}
+	}
+	r.Register(http.MethodGet, "api/v1/projects", handle("list"))
+	r.Register(http.MethodGet, "api/v1/projects/{name}", handle("project"))
+	r.Register(http.MethodGet, "api/v1/projects/{name}/tree/*path", handle("tree"))
+	r.Register(http.MethodPost, "api/v1/projects/{name}/{action}", handle("action"))
+	r.Register(http.MethodGet, "api/v1/projects/{name}/history", handle("history"))
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		params Params
+	}{
+		{http.MethodGet, "/api/v1/projects", http.StatusOK, Params{}},
+		{http.MethodGet, "/api/v1/projects/", http.StatusOK, Params{}},
+		{http.MethodGet, "/api/v1/projects/my%20project", http.StatusOK, Params{"name": "my project"}},
+		{http.MethodGet, "/api/v1/projects/demo/tree", http.StatusOK, Params{"name": "demo", "path": ""}},
+		{http.MethodGet, "/api/v1/projects/demo/tree/a/b%2Fc", http.StatusOK, Params{"name": "demo", "path": "a/b/c"}},
+		{http.MethodGet, "/api/v1/projects/demo/tree/%2e%2e/%2E%2E", http.StatusOK, Params{"name": "demo", "path": "../.."}},
+		{http.MethodGet, "/api/v1/projects/demo/history", http.StatusOK, Params{"name": "demo"}},
+		{http.MethodPost, "/api/v1/projects/demo/sync", http.StatusOK, Params{"name": "demo", "action": "sync"}},
+		{http.MethodGet, "/api/v1/projects/demo/sync", http.StatusMethodNotAllowed, nil},
+		{http.MethodHead, "/api/v1/projects", http.StatusOK, Params{}},
+		{http.MethodGet, "/api/v2/projects", http.StatusNotFound, nil},
+		{http.MethodGet, "/api/v1/projects/demo/a/b", http.StatusNotFound, nil},
+	}
+	for _, c := range cases {
+		_, params, status, _ := r.Lookup(c.method, c.path)
+		if status != c.status {
+			t.Errorf("%s %s: status %d, expect %d", c.method, c.path, status, c.status)
+			continue
+		}
+		if c.params != nil && !reflect.DeepEqual(params, c.params) {
+			t.Errorf("%s %s: params %v, expect %v", c.method, c.path, params, c.params)
+		}
+	}
+	if _, _, _, allow := r.Lookup(http.MethodDelete, "/api/v1/projects/demo/sync"); !reflect.DeepEqual(allow, []string{http.MethodPost}) {
+		t.Errorf("allow %v, expect [POST]", allow)
+	}
+}
@@ -1,47 +1,127 @@
 package web
 
 import (
-	"fmt"
+	"conf"
+	"metrics"
 	"net/http"
 	"project"
 	"strings"
+	"util"
 	"web/resource"
 	"web/router"
 )
 
+const defaultListen = "127.0.0.1:8090"
+
 type HttpServerHandle struct {
-	projects map[string]*project.Project
+	projects *project.Projects
+	auth *authenticator
 }
 
 func (h *HttpServerHandle) RegisterRouters() {
-	for key, value := range h.projects {
-		router.RouterTable.Register(key, resource.NewDirTreeResource(value))
+	api := resource.ApiPrefix + "/projects/{name}"
+	table := router.RouterTable
+	table.Register(http.MethodGet, "", h.serveDashboard)
+	table.Register(http.MethodGet, "dashboard", h.serveDashboard)
+	table.Register(http.MethodGet, "metrics", h.serveMetrics)
+	table.Register(http.MethodGet, resource.ApiPrefix+"/events", h.serveEvents)
+	table.Register(http.MethodGet, resource.ApiPrefix+"/projects", serve(resource.NewProjectListResource(h.projects).Get))
+	table.Register(http.MethodGet, api, serve(resource.NewProjectResource(h.projects).Get))
+	table.Register(http.MethodGet, api+"/tree/*path", serve(resource.NewProjectTreeResource(h.projects).Get))
+	table.Register(http.MethodGet, api+"/history", serve(resource.NewProjectHistoryResource(h.projects).Get))
+	table.Register(http.MethodGet, api+"/journal", serve(resource.NewProjectJournalResource(h.projects).Get))
+	table.Register(http.MethodGet, api+"/remote/*path", serve(resource.NewProjectRemoteResource(h.projects).Get))
+	diff := resource.NewProjectDiffResource(h.projects)
+	table.Register(http.MethodGet, api+"/diff/*path", serve(diff.Get))
+	table.Register(http.MethodPost, api+"/diff/*path", serve(diff.Post))
+	table.Register(http.MethodPost, api+"/{action}", serve(resource.NewProjectActionResource(h.projects).Post))
+	//兼容旧的访问路径
+	table.Register(http.MethodGet, "{name}", serve(resource.NewDirTreeResource(h.projects).Get))
+	table.Register(http.MethodPost, "{name}/sync", serve(resource.NewSyncResource(h.projects).Post))
+}
+
+//将资源的处理函数转换为路由处理函数
+func serve(handler resource.Handler) router.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params router.Params) {
+		writeResponse(w, handler(&resource.Request{
+			Params: params,
+			Query:  r.URL.Query(),
+		}))
 	}
 }
 
+func writeResponse(w http.ResponseWriter, res *resource.Response) {
+	w.Header().Set("Content-Type", res.ContentType)
+	w.WriteHeader(res.Status)
+	w.Write([]byte(res.Body))
+}
+
+//通过查询参数中的token打开页面时保存到cookie，页面中的查询和事件流不需要再传递token
+func (h *HttpServerHandle) serveDashboard(w http.ResponseWriter, r *http.Request, params router.Params) {
+	if token := r.URL.Query().Get(tokenParam); len(token) != 0 && h.auth != nil && h.auth.tokenRole(token) != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(dashboardHtml))
+}
+
+func (h *HttpServerHandle) serveMetrics(w http.ResponseWriter, r *http.Request, params router.Params) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteText(w)
+}
+
 func (h *HttpServerHandle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if len(r.URL.Path) < 2 {
-		w.Write([]byte("Invalid url"))
+	if h.auth != nil && !h.auth.authorize(w, r) {
 		return
 	}
-	handle, err := router.RouterTable.GetRouter(r.URL.Path[1:])
-	if err != nil {
-		w.Write([]byte(err.Error()))
+	handle, params, status, allow := router.RouterTable.Lookup(r.Method, r.URL.EscapedPath())
+	if status == http.StatusOK {
+		handle(w, r, params)
 		return
 	}
-	keys := strings.Split(r.URL.RawQuery, "=")
-	if len(keys) != 2 || keys[0] != "path" {
-		w.Write([]byte("Invalid url"))
+	if len(allow) != 0 {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+	}
+	if strings.HasPrefix(r.URL.Path, "/"+resource.ApiPrefix+"/") {
+		writeResponse(w, resource.JsonError(status, http.StatusText(status)))
 		return
 	}
-	w.Write([]byte(handle.Get(keys[1])))
+	http.Error(w, http.StatusText(status), status)
 }
 
-func WebServerStart(projects map[string]*project.Project){
-	handle := &HttpServerHandle{projects:projects}
+//projects在重新加载配置时增删，路由按项目名称参数匹配，不需要重新注册
+func WebServerStart(projects *project.Projects, config *conf.WebConfig){
+	if config == nil {
+		config = new(conf.WebConfig)
+	}
+	auth, err := newAuthenticator(config)
+	if err != nil {
+		util.Error("http server auth config invalid", util.F("error", err))
+		return
+	}
+	handle := &HttpServerHandle{projects:projects, auth:auth}
 	handle.RegisterRouters()
-	if err := http.ListenAndServe(":8090", handle); err != nil {
-		fmt.Println("http server listen failed:", err)
+	listen := config.Listen
+	if len(listen) == 0 {
+		listen = defaultListen
+	}
+	if (len(config.CertFile) == 0) != (len(config.KeyFile) == 0) {
+		util.Error("http server tls config invalid: cert_file and key_file must be set together")
+		return
+	}
+	if len(config.CertFile) != 0 {
+		err = http.ListenAndServeTLS(listen, config.CertFile, config.KeyFile, handle)
+	}else{
+		err = http.ListenAndServe(listen, handle)
+	}
+	if err != nil {
+		util.Error("http server listen failed", util.F("listen", listen), util.F("error", err))
 	}
-
 }